@@ -0,0 +1,115 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Archiver writes a gzip compressed tar file incrementally, with entries
+// added one at a time from any source. This allows building an archive as
+// content becomes available, without walking a directory. Call Close to finish
+// writing the archive.
+type Archiver struct {
+	aw  *archiveWriter
+	a   *archiver
+	err error
+}
+
+// NewArchiver returns an Archiver that writes an archive to w. The options
+// that apply to the headers and compression of created archives are used. If
+// the options are not valid, then the error is returned by every method.
+func NewArchiver(w io.Writer, options ...Option) *Archiver {
+	opts := getOpts(options)
+	aw, err := newArchiveWriter(w, &opts, nil)
+	if err != nil {
+		return &Archiver{err: err}
+	}
+	return &Archiver{
+		aw: aw,
+		a:  newArchiver(aw.tw, &opts, ""),
+	}
+}
+
+// AddFile adds a regular file entry, with the given name, whose content is
+// read from r. The permissions, modification time, and size of the entry are
+// taken from fi, and exactly fi.Size() bytes must be read from r.
+//
+// The name must be a relative path that does not refer outside of the archive
+// root. Any OS-specific path separators are converted to forward slashes.
+func (ar *Archiver) AddFile(name string, r io.Reader, fi os.FileInfo) error {
+	if ar.err != nil {
+		return ar.err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", name)
+	}
+	name, err := cleanEntryName(name)
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err = ar.a.writeHeader(hdr, name); err != nil {
+		return ar.fail(err)
+	}
+	n, err := copyContext(ar.a.opts.ctx, ar.aw.tw, r)
+	if err != nil {
+		return ar.fail(fmt.Errorf("cannot read %s: %w", name, err))
+	}
+	if n != hdr.Size {
+		return ar.fail(fmt.Errorf("read %d bytes of %s, expected %d", n, name, hdr.Size))
+	}
+	return nil
+}
+
+// AddDir adds a directory entry with the given name. The directory has
+// default permissions, 0755, and the current time as its modification time.
+// Entries for the directories containing a file do not need to be added, since
+// extraction creates them as needed.
+func (ar *Archiver) AddDir(name string) error {
+	if ar.err != nil {
+		return ar.err
+	}
+	name, err := cleanEntryName(name)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     defaultDirMode,
+		ModTime:  time.Now(),
+	}
+	if err = ar.a.writeHeader(hdr, name); err != nil {
+		return ar.fail(err)
+	}
+	return nil
+}
+
+// Close finishes writing the archive. It does not close the underlying
+// writer.
+func (ar *Archiver) Close() error {
+	if ar.err != nil {
+		return ar.err
+	}
+	ar.err = errArchiverClosed
+	return ar.aw.close()
+}
+
+// errArchiverClosed is returned when using an Archiver after it is closed.
+var errArchiverClosed = errors.New("archiver is closed")
+
+// fail records an error that leaves the archive incomplete, so that the
+// archive cannot be written further.
+func (ar *Archiver) fail(err error) error {
+	ar.aw.abort()
+	ar.err = err
+	return err
+}
@@ -0,0 +1,58 @@
+package targz_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiver(t *testing.T) {
+	modTime := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"report.txt": {Data: []byte("report"), Mode: 0640, ModTime: modTime},
+		"data.bin":   {Data: []byte("binary data"), Mode: 0600, ModTime: modTime},
+	}
+	reportInfo, err := fsys.Stat("report.txt")
+	require.NoError(t, err)
+	dataInfo, err := fsys.Stat("data.bin")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	ar := targz.NewArchiver(&buf)
+	require.NoError(t, ar.AddDir("results"))
+	require.NoError(t, ar.AddFile("results/report.txt", strings.NewReader("report"), reportInfo))
+	// Parent directory entry is not needed.
+	require.NoError(t, ar.AddFile("raw/data.bin", strings.NewReader("binary data"), dataInfo))
+	require.Error(t, ar.AddFile("../escape", strings.NewReader("report"), reportInfo))
+	require.NoError(t, ar.Close())
+	require.Error(t, ar.AddDir("late"))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "results", "report.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "report", string(data))
+	fi, err := os.Stat(filepath.Join(outDir, "raw", "data.bin"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	require.True(t, modTime.Equal(fi.ModTime()))
+	require.DirExists(t, filepath.Join(outDir, "results"))
+
+	// Content shorter than size is an error.
+	buf.Reset()
+	ar = targz.NewArchiver(&buf)
+	err = ar.AddFile("short.txt", strings.NewReader("rep"), reportInfo)
+	require.ErrorContains(t, err, "read 3 bytes")
+	require.Error(t, ar.Close())
+
+	// Invalid options are reported.
+	ar = targz.NewArchiver(&buf, targz.WithCompressionLevel(100))
+	require.ErrorContains(t, ar.AddDir("dir"), "invalid compression level")
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package targz
+
+import (
+	"errors"
+	"syscall"
+)
+
+const capabilityXattr = "security.capability"
+
+// getCapability returns the file capabilities of the named file, or nil if the
+// file has no capabilities.
+func getCapability(name string) ([]byte, error) {
+	buf := make([]byte, 64)
+	for {
+		n, err := syscall.Getxattr(name, capabilityXattr, buf)
+		if err != nil {
+			switch {
+			case errors.Is(err, syscall.ENODATA), errors.Is(err, syscall.ENOTSUP):
+				return nil, nil
+			case errors.Is(err, syscall.ERANGE):
+				buf = make([]byte, len(buf)*2)
+				continue
+			}
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// setCapability sets the file capabilities of the named file.
+func setCapability(name string, value []byte) error {
+	return syscall.Setxattr(name, capabilityXattr, value, 0)
+}
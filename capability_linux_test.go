@@ -0,0 +1,75 @@
+//go:build linux
+
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapabilities(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("setting file capabilities requires root")
+	}
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	exePath := filepath.Join(srcDir, "server")
+	require.NoError(t, os.WriteFile(exePath, []byte("#!/bin/sh\n"), 0750))
+
+	// Build version 2 capability data granting effective CAP_NET_BIND_SERVICE.
+	const (
+		vfsCapRevision2   = 0x02000000
+		vfsCapEffective   = 0x000001
+		capNetBindService = 10
+	)
+	capData := make([]byte, 20)
+	binary.LittleEndian.PutUint32(capData[0:], vfsCapRevision2|vfsCapEffective)
+	binary.LittleEndian.PutUint32(capData[4:], 1<<capNetBindService)
+	if err := syscall.Setxattr(exePath, "security.capability", capData, 0); err != nil {
+		t.Skipf("filesystem does not support file capabilities: %s", err)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithCapabilities(true)))
+	archive := buf.Bytes()
+
+	// Check that the capability is in the archive.
+	gzr, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var found bool
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		if hdr.Name == "src/server" {
+			require.Equal(t, string(capData), hdr.PAXRecords["SCHILY.xattr.security.capability"])
+			found = true
+		}
+	}
+	require.True(t, found)
+
+	// Capability is restored when enabled.
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithCapabilities(true)))
+	got := make([]byte, 64)
+	n, err := syscall.Getxattr(filepath.Join(outDir, "src", "server"), "security.capability", got)
+	require.NoError(t, err)
+	require.Equal(t, capData, got[:n])
+
+	// Capability is not restored when not enabled.
+	outDir = t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir))
+	_, err = syscall.Getxattr(filepath.Join(outDir, "src", "server"), "security.capability", got)
+	require.ErrorIs(t, err, syscall.ENODATA)
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package targz
+
+import "errors"
+
+// getCapability returns nil since file capabilities are only supported on
+// Linux.
+func getCapability(name string) ([]byte, error) {
+	return nil, nil
+}
+
+// setCapability returns an error since file capabilities are only supported
+// on Linux.
+func setCapability(name string, value []byte) error {
+	return errors.New("file capabilities not supported on this platform")
+}
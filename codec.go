@@ -0,0 +1,70 @@
+package targz
+
+import (
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression format used to create an archive.
+type Codec int
+
+const (
+	// CodecGzip compresses archives using gzip. This is the default.
+	CodecGzip Codec = iota
+	// CodecZstd compresses archives using Zstandard, which is typically
+	// faster and compresses better than gzip.
+	CodecZstd
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecGzip:
+		return "gzip"
+	case CodecZstd:
+		return "zstd"
+	}
+	return "unknown"
+}
+
+// format returns the archive format produced by the codec.
+func (c Codec) format() archiveFormat {
+	if c == CodecZstd {
+		return formatZstd
+	}
+	return formatGzip
+}
+
+// extension returns the file name extension of an archive produced by the
+// codec.
+func (c Codec) extension() string {
+	if c == CodecZstd {
+		return ".tar.zst"
+	}
+	return ".tar.gz"
+}
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// newZstdWriter returns a writer that compresses data, written to it, using
+// zstd, and writes the compressed data to w.
+func newZstdWriter(w io.Writer, opts *config) (io.WriteCloser, error) {
+	if opts.compressionDict != nil {
+		return nil, errors.New("compression dictionary is not supported with zstd")
+	}
+	var zopts []zstd.EOption
+	if opts.levelSet {
+		zopts = append(zopts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(opts.compressionLevel)))
+	}
+	return zstd.NewWriter(w, zopts...)
+}
+
+// newZstdReader returns a reader of the data decompressed from r using zstd.
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
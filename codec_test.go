@@ -0,0 +1,57 @@
+package targz_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodec(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	data := bytes.Repeat([]byte("compressible data "), 1000)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "file.txt"), data, 0640))
+
+	for _, codec := range []targz.Codec{targz.CodecGzip, targz.CodecZstd} {
+		t.Run(codec.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithCodec(codec)))
+			if codec == targz.CodecZstd {
+				require.Equal(t, []byte{0x28, 0xb5, 0x2f, 0xfd}, buf.Bytes()[:4])
+			} else {
+				require.Equal(t, []byte{0x1f, 0x8b}, buf.Bytes()[:2])
+			}
+			require.Less(t, buf.Len(), len(data))
+
+			// Format is detected without specifying codec.
+			var warnings []string
+			outDir := t.TempDir()
+			err := targz.ExtractReader(bytes.NewReader(buf.Bytes()), outDir, targz.WithWarningHandler(func(msg string) {
+				warnings = append(warnings, msg)
+			}))
+			require.NoError(t, err)
+			got, err := os.ReadFile(filepath.Join(outDir, "src", "sub", "file.txt"))
+			require.NoError(t, err)
+			require.Equal(t, data, got)
+			if codec == targz.CodecZstd {
+				require.Len(t, warnings, 1)
+			} else {
+				require.Empty(t, warnings)
+			}
+
+			outDir = t.TempDir()
+			require.NoError(t, targz.ExtractReader(&buf, outDir, targz.WithCodec(codec)))
+			got, err = os.ReadFile(filepath.Join(outDir, "src", "sub", "file.txt"))
+			require.NoError(t, err)
+			require.Equal(t, data, got)
+		})
+	}
+
+	var buf bytes.Buffer
+	err := targz.CreateWriter(srcDir, &buf, targz.WithCodec(targz.CodecZstd), targz.WithCompressionLevel(19))
+	require.NoError(t, err)
+}
@@ -0,0 +1,107 @@
+package targz
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"io"
+	"os"
+	"sort"
+)
+
+// archiveEntryInfo is the header and content hash of an archive entry.
+type archiveEntryInfo struct {
+	hdr *tar.Header
+	sum [sha256.Size]byte
+}
+
+// ArchivesEqual compares the entries of two archives, and returns true if they
+// have the same entries with the same content. The compression of the archives
+// and the order of entries are not compared. Entries with the same name must
+// have the same type, link target, size, and content, and by default the same
+// modification time, ownership, and mode. WithIgnoreModTime, WithIgnoreOwner,
+// and WithIgnoreMode exclude these from the comparison.
+//
+// The names of all entries that differ, including entries that are only in
+// one archive, are returned in lexical order.
+func ArchivesEqual(pathA, pathB string, options ...Option) (bool, []string, error) {
+	opts := getOpts(options)
+	entriesA, err := readEntryInfo(pathA, &opts)
+	if err != nil {
+		return false, nil, err
+	}
+	entriesB, err := readEntryInfo(pathB, &opts)
+	if err != nil {
+		return false, nil, err
+	}
+
+	var diffs []string
+	for name, a := range entriesA {
+		b, ok := entriesB[name]
+		if !ok || !opts.sameEntry(a, b) {
+			diffs = append(diffs, name)
+		}
+	}
+	for name := range entriesB {
+		if _, ok := entriesA[name]; !ok {
+			diffs = append(diffs, name)
+		}
+	}
+	sort.Strings(diffs)
+	return len(diffs) == 0, diffs, nil
+}
+
+// readEntryInfo reads the header and content hash of each entry in the
+// archive at tarPath.
+func readEntryInfo(tarPath string, opts *config) (map[string]archiveEntryInfo, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rc, err := decompressReader(f, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	entries := map[string]archiveEntryInfo{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		h := sha256.New()
+		if _, err = io.Copy(h, tr); err != nil {
+			return nil, err
+		}
+		info := archiveEntryInfo{hdr: hdr}
+		copy(info.sum[:], h.Sum(nil))
+		entries[hdr.Name] = info
+	}
+}
+
+// sameEntry returns true if the entries are the same, ignoring any metadata
+// that the options exclude from comparison.
+func (c *config) sameEntry(a, b archiveEntryInfo) bool {
+	ha, hb := a.hdr, b.hdr
+	if ha.Typeflag != hb.Typeflag || ha.Linkname != hb.Linkname || ha.Size != hb.Size || a.sum != b.sum {
+		return false
+	}
+	if !c.ignoreModTime && !ha.ModTime.Equal(hb.ModTime) {
+		return false
+	}
+	if !c.ignoreOwner && (ha.Uid != hb.Uid || ha.Gid != hb.Gid || ha.Uname != hb.Uname || ha.Gname != hb.Gname) {
+		return false
+	}
+	if !c.ignoreMode && ha.Mode != hb.Mode {
+		return false
+	}
+	return true
+}
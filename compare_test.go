@@ -0,0 +1,62 @@
+package targz_test
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchivesEqual(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("aaaaaaaaaaaaaaaa"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("bbbbbbbbbbbbbbbb"), 0640))
+
+	pathA := filepath.Join(tmpDir, "a.tar.gz")
+	pathB := filepath.Join(tmpDir, "b.tar.gz")
+	require.NoError(t, targz.Create(srcDir, pathA, targz.WithCompressionLevel(gzip.BestSpeed)))
+	require.NoError(t, targz.Create(srcDir, pathB, targz.WithCompressionLevel(gzip.BestCompression),
+		targz.WithStampCreationTime(true)))
+
+	equal, diffs, err := targz.ArchivesEqual(pathA, pathB)
+	require.NoError(t, err)
+	require.True(t, equal)
+	require.Empty(t, diffs)
+
+	// Change metadata only.
+	mt := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(srcDir, "a.txt"), mt, mt))
+	require.NoError(t, os.Chmod(filepath.Join(srcDir, "sub", "b.txt"), 0600))
+	require.NoError(t, targz.Create(srcDir, pathB))
+
+	equal, diffs, err = targz.ArchivesEqual(pathA, pathB)
+	require.NoError(t, err)
+	require.False(t, equal)
+	require.Equal(t, []string{"src/a.txt", "src/sub/b.txt"}, diffs)
+
+	_, diffs, err = targz.ArchivesEqual(pathA, pathB, targz.WithIgnoreModTime(true))
+	require.NoError(t, err)
+	require.Equal(t, []string{"src/sub/b.txt"}, diffs)
+
+	equal, _, err = targz.ArchivesEqual(pathA, pathB, targz.WithIgnoreModTime(true), targz.WithIgnoreMode(true),
+		targz.WithIgnoreOwner(true))
+	require.NoError(t, err)
+	require.True(t, equal)
+
+	// Change content and entries.
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("aaaaaaaaaaaaaaaX"), 0640))
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "sub", "b.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "c.txt"), nil, 0640))
+	require.NoError(t, targz.Create(srcDir, pathB))
+
+	equal, diffs, err = targz.ArchivesEqual(pathA, pathB, targz.WithIgnoreModTime(true))
+	require.NoError(t, err)
+	require.False(t, equal)
+	require.Equal(t, []string{"src/a.txt", "src/c.txt", "src/sub/b.txt"}, diffs)
+}
@@ -0,0 +1,182 @@
+package targz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const tarBlockSize = 512
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+var bzip2Magic = []byte("BZh")
+
+// archiveFormat identifies the format of archive data.
+type archiveFormat int
+
+const (
+	formatUnknown archiveFormat = iota
+	formatTar
+	formatGzip
+	formatZstd
+	formatBzip2
+)
+
+func (f archiveFormat) String() string {
+	switch f {
+	case formatTar:
+		return "uncompressed tar"
+	case formatGzip:
+		return "gzip"
+	case formatZstd:
+		return "zstd"
+	case formatBzip2:
+		return "bzip2"
+	}
+	return "unknown"
+}
+
+// formatFromName returns the archive format indicated by the extension of the
+// file name.
+func formatFromName(name string) archiveFormat {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return formatTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return formatGzip
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return formatZstd
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"), strings.HasSuffix(name, ".tbz"):
+		return formatBzip2
+	}
+	return formatUnknown
+}
+
+// decompressReader returns a reader of the uncompressed tar data from r. The
+// compression format is detected from the data. If the data is not in the
+// format of the configured codec, which is gzip by default, then a warning is
+// issued. Gzip, zstd, bzip2, and uncompressed tar data are read.
+func decompressReader(r io.Reader, opts *config) (io.ReadCloser, error) {
+	return decompressFormat(r, opts.codec.format(), opts)
+}
+
+// decompressFormat returns a reader of the uncompressed tar data from r. The
+// format of the data is detected from its content. If the detected format is
+// different from the expected format, then a warning is issued. If the format
+// cannot be detected, then the data is read as gzip.
+func decompressFormat(r io.Reader, expect archiveFormat, opts *config) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if _, err := br.Peek(1); err == io.EOF {
+		return nil, ErrEmptyArchive
+	}
+
+	var actual archiveFormat
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		actual = formatGzip
+	} else if magic, _ = br.Peek(len(zstdMagic)); bytes.Equal(magic, zstdMagic) {
+		actual = formatZstd
+	} else if magic, _ = br.Peek(len(bzip2Magic) + 1); isBzip2(magic) {
+		actual = formatBzip2
+	} else if block, err := br.Peek(tarBlockSize); err == nil && isTarHeader(block) {
+		actual = formatTar
+	}
+	if actual != formatUnknown && expect != formatUnknown && actual != expect {
+		opts.warn(fmt.Sprintf("archive data is %s, not %s", actual, expect))
+	}
+
+	switch actual {
+	case formatTar:
+		return io.NopCloser(br), nil
+	case formatZstd:
+		return newZstdReader(br)
+	case formatBzip2:
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	}
+	if opts.compressionDict != nil {
+		return newDictGzipReader(br, opts.compressionDict)
+	}
+	return gzip.NewReader(br)
+}
+
+// isBzip2 returns true if the data starts with the bzip2 magic bytes followed
+// by a block size digit.
+func isBzip2(magic []byte) bool {
+	return len(magic) == len(bzip2Magic)+1 && bytes.HasPrefix(magic, bzip2Magic) &&
+		magic[len(bzip2Magic)] >= '1' && magic[len(bzip2Magic)] <= '9'
+}
+
+// newCompressor returns a writer that compresses data written to it, and
+// writes the compressed data to w.
+func newCompressor(w io.Writer, opts *config) (io.WriteCloser, error) {
+	if opts.codec == CodecZstd {
+		return newZstdWriter(w, opts)
+	}
+	level := opts.level()
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return nil, fmt.Errorf("invalid compression level %d", level)
+	}
+	if opts.compressionDict != nil {
+		return newDictGzipWriter(w, level, opts.compressionDict, opts.gzipModTime)
+	}
+	if opts.parallelGzip {
+		workers := opts.compressionWorkers
+		if workers == 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		if workers > 1 {
+			return newParallelGzipWriter(w, workers, level, opts.gzipModTime), nil
+		}
+	}
+	gzw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	gzw.ModTime = opts.gzipModTime
+	return gzw, nil
+}
+
+// isTarHeader returns true if the block is a valid tar header, determined by
+// the header checksum, or is a zero block that marks the end of a tar archive.
+func isTarHeader(block []byte) bool {
+	if len(block) < tarBlockSize {
+		return false
+	}
+	block = block[:tarBlockSize]
+
+	// Check for end of archive marker.
+	zero := true
+	for _, b := range block {
+		if b != 0 {
+			zero = false
+			break
+		}
+	}
+	if zero {
+		return true
+	}
+
+	// Header checksum is the sum of all header bytes, with the checksum field
+	// itself counted as spaces.
+	const chkOff, chkLen = 148, 8
+	field := strings.Trim(string(block[chkOff:chkOff+chkLen]), " \x00")
+	want, err := strconv.ParseInt(field, 8, 64)
+	if err != nil {
+		return false
+	}
+	var sum int64
+	for i, b := range block {
+		if i >= chkOff && i < chkOff+chkLen {
+			b = ' '
+		}
+		sum += int64(b)
+	}
+	return sum == want
+}
@@ -0,0 +1,199 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractUncompressedTar(t *testing.T) {
+	data := []byte("not compressed")
+	plain := plainTar(t, data)
+
+	tarPath := filepath.Join(t.TempDir(), "mislabeled.tar.gz")
+	require.NoError(t, os.WriteFile(tarPath, plain, 0640))
+
+	outDir := t.TempDir()
+	var warnings []string
+	err := targz.Extract(tarPath, outDir, targz.WithWarningHandler(func(msg string) {
+		warnings = append(warnings, msg)
+	}))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "not gzip")
+
+	got, err := os.ReadFile(filepath.Join(outDir, "plain", "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func TestExtractNotArchive(t *testing.T) {
+	junk := bytes.Repeat([]byte("junk"), 200)
+	var warnings []string
+	err := targz.ExtractReader(bytes.NewReader(junk), t.TempDir(), targz.WithWarningHandler(func(msg string) {
+		warnings = append(warnings, msg)
+	}))
+	require.Error(t, err)
+	require.Empty(t, warnings)
+}
+
+func TestExtractAuto(t *testing.T) {
+	data := []byte("some data")
+	plain := plainTar(t, data)
+	var gz bytes.Buffer
+	gzw := gzip.NewWriter(&gz)
+	_, err := gzw.Write(plain)
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+
+	tests := []struct {
+		name    string
+		content []byte
+		warn    bool
+	}{
+		{"test.tar", plain, false},
+		{"test.tar.gz", gz.Bytes(), false},
+		{"test.tgz", gz.Bytes(), false},
+		{"TEST.TAR.GZ", gz.Bytes(), false},
+		{"test.archive", plain, false},
+		{"test.archive", gz.Bytes(), false},
+		{"gzip.tar", gz.Bytes(), true},
+		{"plain.tar.gz", plain, true},
+	}
+	for _, tc := range tests {
+		tarPath := filepath.Join(t.TempDir(), tc.name)
+		require.NoError(t, os.WriteFile(tarPath, tc.content, 0640))
+
+		outDir := t.TempDir()
+		var warnings []string
+		err = targz.ExtractAuto(tarPath, outDir, targz.WithWarningHandler(func(msg string) {
+			warnings = append(warnings, msg)
+		}))
+		require.NoError(t, err, tc.name)
+		if tc.warn {
+			require.Len(t, warnings, 1, tc.name)
+		} else {
+			require.Empty(t, warnings, tc.name)
+		}
+
+		got, err := os.ReadFile(filepath.Join(outDir, "plain", "file.txt"))
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+	}
+}
+
+func TestExtractReaderDetectFormat(t *testing.T) {
+	data := []byte("detected")
+	plain := plainTar(t, data)
+	var gzBuf bytes.Buffer
+	gzw := gzip.NewWriter(&gzBuf)
+	_, err := gzw.Write(plain)
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+
+	archives := map[string][]byte{
+		"tar":    plain,
+		"tar.gz": gzBuf.Bytes(),
+	}
+	if bz, err := exec.LookPath("bzip2"); err == nil {
+		cmd := exec.Command(bz, "-c")
+		cmd.Stdin = bytes.NewReader(plain)
+		out, err := cmd.Output()
+		require.NoError(t, err)
+		archives["tar.bz2"] = out
+	}
+
+	for name, archive := range archives {
+		outDir := t.TempDir()
+		require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithWarningHandler(func(string) {})), name)
+		got, err := os.ReadFile(filepath.Join(outDir, "plain", "file.txt"))
+		require.NoError(t, err, name)
+		require.Equal(t, data, got, name)
+	}
+}
+
+func TestGzipModTime(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+
+	gzipModTime := func(archive []byte) time.Time {
+		gzr, err := gzip.NewReader(bytes.NewReader(archive))
+		require.NoError(t, err)
+		return gzr.ModTime
+	}
+
+	// Default is zero time.
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	require.True(t, gzipModTime(buf.Bytes()).IsZero())
+	require.Zero(t, binary.LittleEndian.Uint32(buf.Bytes()[4:8]))
+
+	mt := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	buf.Reset()
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithGzipModTime(mt)))
+	require.True(t, mt.Equal(gzipModTime(buf.Bytes())))
+
+	// Same with dictionary compression.
+	buf.Reset()
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithGzipModTime(mt), targz.WithCompressionDict([]byte("a"))))
+	require.True(t, mt.Equal(gzipModTime(buf.Bytes())))
+}
+
+func TestCompressionLevel(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 20000)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "log.txt"), text, 0640))
+
+	archiveSize := func(level int) int {
+		var buf bytes.Buffer
+		require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithCompressionLevel(level)))
+		return buf.Len()
+	}
+	stored := archiveSize(gzip.NoCompression)
+	fast := archiveSize(gzip.BestSpeed)
+	best := archiveSize(gzip.BestCompression)
+	require.Greater(t, stored, len(text))
+	require.Less(t, fast, stored)
+	require.Less(t, best, fast)
+
+	for _, level := range []int{gzip.HuffmanOnly - 1, gzip.BestCompression + 1} {
+		var buf bytes.Buffer
+		err := targz.CreateWriter(srcDir, &buf, targz.WithCompressionLevel(level))
+		require.ErrorContains(t, err, "invalid compression level")
+		err = targz.CreateWriter(srcDir, &buf, targz.WithCompressionLevel(level), targz.WithParallelGzip(true))
+		require.ErrorContains(t, err, "invalid compression level")
+	}
+}
+
+// plainTar returns an uncompressed tar archive containing a directory and a
+// file with the given data.
+func plainTar(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     "plain/",
+		Typeflag: tar.TypeDir,
+		Mode:     0750,
+	}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     "plain/file.txt",
+		Typeflag: tar.TypeReg,
+		Mode:     0640,
+		Size:     int64(len(data)),
+	}))
+	_, err := tw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
@@ -0,0 +1,73 @@
+package targz
+
+import (
+	"context"
+	"io"
+)
+
+// CreateContext is the same as Create, except that creating the archive stops
+// if ctx is canceled. The context is checked before each file is archived and
+// while file data is copied, so that archiving a large file is interrupted.
+// If ctx is canceled, then ctx.Err() is returned.
+func CreateContext(ctx context.Context, dir, tarPath string, options ...Option) error {
+	return Create(dir, tarPath, withContext(ctx, options)...)
+}
+
+// CreateWriterContext is the same as CreateWriter, except that creating the
+// archive stops, and ctx.Err() is returned, if ctx is canceled.
+func CreateWriterContext(ctx context.Context, dir string, w io.Writer, options ...Option) error {
+	return CreateWriter(dir, w, withContext(ctx, options)...)
+}
+
+// ExtractContext is the same as Extract, except that extraction stops if ctx
+// is canceled. The context is checked before each entry is extracted and while
+// file data is copied, so that extracting a large file is interrupted. If ctx
+// is canceled, then ctx.Err() is returned.
+func ExtractContext(ctx context.Context, tarPath, targetDir string, options ...Option) error {
+	return Extract(tarPath, targetDir, withContext(ctx, options)...)
+}
+
+// ExtractReaderContext is the same as ExtractReader, except that extraction
+// stops, and ctx.Err() is returned, if ctx is canceled.
+func ExtractReaderContext(ctx context.Context, r io.Reader, targetDir string, options ...Option) error {
+	return ExtractReader(r, targetDir, withContext(ctx, options)...)
+}
+
+// withContext returns the options with an additional option that sets the
+// context.
+func withContext(ctx context.Context, options []Option) []Option {
+	return append(options[:len(options):len(options)], func(c *config) {
+		c.ctx = ctx
+	})
+}
+
+// ctxErr returns the error of the configured context, or nil if there is no
+// context or it is not canceled.
+func (c *config) ctxErr() error {
+	if c.ctx == nil {
+		return nil
+	}
+	return c.ctx.Err()
+}
+
+// copyContext copies from src to dst, the same as io.Copy, but stops and
+// returns ctx.Err() if ctx is canceled. A nil ctx is never canceled.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	if ctx == nil {
+		return io.Copy(dst, src)
+	}
+	return io.Copy(dst, &ctxReader{ctx: ctx, r: src})
+}
+
+// ctxReader returns the context error from Read once the context is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,107 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelWriter cancels a context after a number of bytes are written.
+type cancelWriter struct {
+	n      int
+	after  int
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	if w.n >= w.after {
+		w.cancel()
+	}
+	return len(p), nil
+}
+
+func (w *cancelWriter) Close() error {
+	return nil
+}
+
+func TestCreateContext(t *testing.T) {
+	const size = 4 * 1024 * 1024
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "big.bin"), make([]byte, size), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "small.txt"), []byte("small"), 0640))
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+
+	require.NoError(t, targz.CreateContext(context.Background(), srcDir, tarPath))
+
+	// Already canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := targz.CreateContext(ctx, srcDir, tarPath)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Canceled while copying large file.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var copied int64
+	mutator := func(hdr *tar.Header, _ string) {
+		if hdr.Name == "src/big.bin" {
+			cancel()
+		}
+	}
+	err = targz.CreateWriterContext(ctx, srcDir, &countWriter{n: &copied}, targz.WithHeaderMutator(mutator),
+		targz.WithCompressionLevel(0))
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, copied, int64(size))
+}
+
+// countWriter counts the bytes written.
+type countWriter struct {
+	n *int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	*w.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestExtractContext(t *testing.T) {
+	const size = 4 * 1024 * 1024
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "big.bin"), make([]byte, size), 0640))
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	require.NoError(t, targz.ExtractContext(context.Background(), tarPath, t.TempDir()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := targz.ExtractContext(ctx, tarPath, t.TempDir())
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Canceled while copying large file.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelWriter{after: 64 * 1024, cancel: cancel}
+	opener := func(string, os.FileMode) (io.WriteCloser, error) {
+		return w, nil
+	}
+	data, err := os.ReadFile(tarPath)
+	require.NoError(t, err)
+	err = targz.ExtractReaderContext(ctx, bytes.NewReader(data), t.TempDir(), targz.WithFileOpener(opener))
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, w.n, size)
+}
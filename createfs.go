@@ -0,0 +1,166 @@
+package targz
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// CreateFromFS writes a gzip compressed tar file to w, containing the contents
+// of the directory root within fsys. This archives files that are not on disk,
+// such as files generated in memory, without first writing them to disk.
+//
+// As with Create, the archive contains the root directory by its base name,
+// along with everything beneath it. If root is ".", then the contents of fsys
+// are archived without a top-level directory, unless one is named by
+// WithBaseName. Entries are written depth-first in lexical order, and are
+// written in the same way as by Create, using the same options. Symbolic links
+// are archived as links if fsys implements fs.ReadLinkFS, and are otherwise
+// skipped with a warning. WithFollowSymlinks and WithCapabilities do not apply,
+// since these read from the files on disk.
+func CreateFromFS(fsys fs.FS, root string, w io.Writer, options ...Option) error {
+	opts := getOpts(options)
+	root = path.Clean(root)
+	if !fs.ValidPath(root) {
+		return fmt.Errorf("invalid root directory %q", root)
+	}
+	var prefix string
+	if root != "." || opts.baseName != "" {
+		name, err := opts.rootName(path.Base(root))
+		if err != nil {
+			return err
+		}
+		prefix = name + "/"
+	}
+
+	if opts.progressFunc != nil {
+		var total int64
+		err := walkFS(fsys, root, prefix, &opts, func(e archiveEntry) error {
+			if e.info.Mode().IsRegular() {
+				total += e.info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		opts.progress = &progressCounter{
+			total:  total,
+			report: opts.progressFunc,
+		}
+	}
+
+	return writeArchive(w, &opts, nil, func(tw *tar.Writer) error {
+		a := newArchiver(tw, &opts, strings.TrimSuffix(prefix, "/"))
+		a.fsys = fsys
+		if err := walkFS(fsys, root, prefix, &opts, a.addEntry); err != nil {
+			return err
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if opts.dirSizeReport != nil {
+			opts.dirSizeReport(a.dirSizes)
+		}
+		return nil
+	})
+}
+
+// walkFS calls fn for the directory root within fsys, and for each
+// subdirectory, regular file, and symbolic link beneath it, in the same order
+// and with the same options that walkDir uses for a directory on disk. Entries
+// are named by their paths relative to root, following prefix. If prefix is
+// empty, then there is no entry for root.
+func walkFS(fsys fs.FS, root, prefix string, opts *config, fn func(archiveEntry) error) error {
+	ignores, err := newIgnoreMatcher(opts)
+	if err != nil {
+		return err
+	}
+	includes, err := newIncludeMatcher(opts)
+	if err != nil {
+		return err
+	}
+	readLinks := canReadLink(fsys)
+
+	// Directories not yet visited, because nothing has been found in them,
+	// when skipping empty directories.
+	var pending []archiveEntry
+
+	return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		var rel string
+		switch {
+		case root == ".":
+			if p != "." {
+				rel = p
+			}
+		case p != root:
+			rel = strings.TrimPrefix(p, root+"/")
+		}
+		if rel == "" && prefix == "" {
+			// No entry for the root of fsys.
+			return nil
+		}
+		if rel != "" && ignores != nil && ignores.match(rel) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := archiveEntry{
+			path: p,
+			name: prefix + rel,
+			info: fi,
+		}
+
+		// Drop pending directories that do not contain this entry, since
+		// nothing was found in them.
+		for len(pending) != 0 {
+			dir := pending[len(pending)-1].path
+			if strings.HasPrefix(p, dir+"/") {
+				break
+			}
+			pending = pending[:len(pending)-1]
+		}
+
+		if d.IsDir() {
+			e.name = strings.TrimSuffix(e.name, "/") + "/"
+			if opts.skipEmptyDirs && rel != "" {
+				// Visit directory when something is found in it. The
+				// top-level directory is always visited.
+				pending = append(pending, e)
+				return nil
+			}
+			return fn(e)
+		}
+
+		mode := fi.Mode()
+		if !mode.IsRegular() && mode&fs.ModeSymlink == 0 {
+			// Skip files that are not regular files or links.
+			return nil
+		}
+		if includes != nil && !includes.match(rel) {
+			return nil
+		}
+		if mode&fs.ModeSymlink != 0 && !readLinks {
+			opts.warn(fmt.Sprintf("skipping symbolic link %s: file system cannot read links", p))
+			return nil
+		}
+		for _, dirEntry := range pending {
+			if err = fn(dirEntry); err != nil {
+				return err
+			}
+		}
+		pending = pending[:0]
+		return fn(e)
+	})
+}
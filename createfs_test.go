@@ -0,0 +1,107 @@
+package targz_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateFromFS(t *testing.T) {
+	modTime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"gen/a.txt":         {Data: []byte("alpha"), Mode: 0640, ModTime: modTime},
+		"gen/sub/b.txt":     {Data: []byte("beta"), Mode: 0600, ModTime: modTime},
+		"gen/sub/skip.log":  {Data: []byte("log"), Mode: 0600},
+		"gen/.hidden":       {Data: []byte("hidden"), Mode: 0600},
+		"other/outside.txt": {Data: []byte("outside"), Mode: 0600},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateFromFS(fsys, "gen", &buf, targz.WithIgnorePattern("*.log")))
+	entries, err := targz.ListReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	require.Equal(t, []string{"gen/", "gen/.hidden", "gen/a.txt", "gen/sub/", "gen/sub/b.txt"}, names)
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "gen", "sub", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "beta", string(data))
+	fi, err := os.Stat(filepath.Join(outDir, "gen", "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+	require.True(t, modTime.Equal(fi.ModTime()))
+
+	// Root of filesystem is archived without a top-level directory.
+	buf.Reset()
+	require.NoError(t, targz.CreateFromFS(fsys, ".", &buf))
+	entries, err = targz.ListReader(&buf)
+	require.NoError(t, err)
+	require.Equal(t, "gen/", entries[0].Name)
+	require.Len(t, entries, 8)
+
+	require.Error(t, targz.CreateFromFS(fsys, "../gen", &buf))
+}
+
+func TestCreateFromFSOptions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"gen/a.txt":       {Data: []byte("same"), Mode: 0640},
+		"gen/b.txt":       {Data: []byte("same"), Mode: 0640},
+		"gen/empty":       {Mode: fs.ModeDir | 0750},
+		"gen/sub/c.txt":   {Data: []byte("other"), Mode: 0640},
+		"gen/sub/nested":  {Mode: fs.ModeDir | 0750},
+		"gen/zzz/d/e.txt": {Data: []byte("e"), Mode: 0640},
+	}
+	listNames := func(archive []byte) []string {
+		entries, err := targz.ListReader(bytes.NewReader(archive))
+		require.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateFromFS(fsys, "gen", &buf, targz.WithSkipEmptyDirs(true)))
+	require.Equal(t, []string{"gen/", "gen/a.txt", "gen/b.txt", "gen/sub/", "gen/sub/c.txt",
+		"gen/zzz/", "gen/zzz/d/", "gen/zzz/d/e.txt"}, listNames(buf.Bytes()))
+
+	buf.Reset()
+	require.NoError(t, targz.CreateFromFS(fsys, "gen", &buf, targz.WithOmitDirEntries(true)))
+	require.Equal(t, []string{"gen/a.txt", "gen/b.txt", "gen/sub/c.txt", "gen/zzz/d/e.txt"}, listNames(buf.Bytes()))
+
+	buf.Reset()
+	require.NoError(t, targz.CreateFromFS(fsys, "gen", &buf, targz.WithDedup(true), targz.WithChecksums(true)))
+	entries, err := targz.ListReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	for _, e := range entries {
+		if e.Name == "gen/b.txt" {
+			require.Equal(t, "gen/a.txt", e.Linkname)
+		}
+	}
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(buf.Bytes()), outDir, targz.WithVerifyChecksums(true)))
+	data, err := os.ReadFile(filepath.Join(outDir, "gen", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "same", string(data))
+
+	var lastDone, lastTotal int64
+	buf.Reset()
+	require.NoError(t, targz.CreateFromFS(fsys, "gen", &buf, targz.WithProgress(func(_ string, done, total int64) {
+		lastDone, lastTotal = done, total
+	})))
+	require.Equal(t, int64(len("same")*2+len("other")+len("e")), lastTotal)
+	require.Equal(t, lastTotal, lastDone)
+}
@@ -0,0 +1,93 @@
+package targz
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Manifest describes the regular files in an archive. It is used as the base
+// for creating a delta archive that contains only files that have changed
+// since the base archive was created.
+type Manifest struct {
+	// Time is the reference time from which modification times in a delta
+	// archive are recorded. This is the latest modification time of any file
+	// in the base archive.
+	Time time.Time
+	// Files maps each regular file's name in the archive to its size and
+	// modification time.
+	Files map[string]ManifestEntry
+}
+
+// ManifestEntry is the size and modification time of a file in a Manifest.
+type ManifestEntry struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// ReadManifest reads the headers of the archive at tarPath and returns a
+// Manifest of its regular files.
+func ReadManifest(tarPath string, options ...Option) (Manifest, error) {
+	opts := getOpts(options)
+	m := Manifest{
+		Files: map[string]ManifestEntry{},
+	}
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+
+	rc, err := decompressReader(f, &opts)
+	if err != nil {
+		return m, err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return m, err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeLink {
+			continue
+		}
+		m.Files[hdr.Name] = ManifestEntry{
+			Size:    hdr.Size,
+			ModTime: hdr.ModTime,
+		}
+		if hdr.ModTime.After(m.Time) {
+			m.Time = hdr.ModTime
+		}
+	}
+	return m, nil
+}
+
+// unchanged returns true if the manifest has a file with the same name, size,
+// and modification time as the file described by hdr.
+func (m *Manifest) unchanged(hdr *tar.Header) bool {
+	entry, ok := m.Files[hdr.Name]
+	if !ok {
+		return false
+	}
+	// Archive modification times have a resolution of one second.
+	return entry.Size == hdr.Size &&
+		entry.ModTime.Round(time.Second).Equal(hdr.ModTime.Round(time.Second))
+}
+
+// setModTimeDelta records the file's modification time in hdr as an offset
+// from the manifest's reference time.
+func (m *Manifest) setModTimeDelta(hdr *tar.Header) {
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = map[string]string{}
+	}
+	delta := hdr.ModTime.Round(time.Second).Sub(m.Time)
+	hdr.PAXRecords[paxMtimeDelta] = strconv.FormatInt(int64(delta/time.Second), 10)
+}
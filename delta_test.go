@@ -0,0 +1,68 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	baseTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{"a.txt", "b.txt", "sub/c.txt"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+		require.NoError(t, os.Chtimes(p, baseTime, baseTime))
+	}
+
+	basePath := filepath.Join(tmpDir, "base.tar.gz")
+	require.NoError(t, targz.Create(srcDir, basePath))
+	manifest, err := targz.ReadManifest(basePath)
+	require.NoError(t, err)
+	require.Len(t, manifest.Files, 3)
+	require.True(t, manifest.Time.Equal(baseTime))
+	require.Equal(t, int64(len("sub/c.txt")), manifest.Files["src/sub/c.txt"].Size)
+
+	// Change one file's content and time, change another's time only, and
+	// add a new file.
+	changeTime := baseTime.Add(10 * time.Minute)
+	bPath := filepath.Join(srcDir, "b.txt")
+	require.NoError(t, os.WriteFile(bPath, []byte("changed content"), 0640))
+	require.NoError(t, os.Chtimes(bPath, changeTime, changeTime))
+	cPath := filepath.Join(srcDir, "sub", "c.txt")
+	require.NoError(t, os.Chtimes(cPath, changeTime, changeTime))
+	newPath := filepath.Join(srcDir, "sub", "new.txt")
+	require.NoError(t, os.WriteFile(newPath, []byte("new"), 0640))
+	require.NoError(t, os.Chtimes(newPath, changeTime, changeTime))
+
+	deltaPath := filepath.Join(tmpDir, "delta.tar.gz")
+	require.NoError(t, targz.Create(srcDir, deltaPath, targz.WithDeltaBase(manifest)))
+
+	f, err := os.Open(deltaPath)
+	require.NoError(t, err)
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var files []string
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		files = append(files, hdr.Name)
+		delta := strconv.Itoa(int(changeTime.Sub(baseTime) / time.Second))
+		require.Equal(t, delta, hdr.PAXRecords["TARGZ.mtime_delta"])
+	}
+	require.Equal(t, []string{"src/b.txt", "src/sub/c.txt", "src/sub/new.txt"}, files)
+}
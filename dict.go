@@ -0,0 +1,148 @@
+package targz
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// gzip header flags.
+const (
+	gzipFlagHdrCRC  = 1 << 1
+	gzipFlagExtra   = 1 << 2
+	gzipFlagName    = 1 << 3
+	gzipFlagComment = 1 << 4
+)
+
+// dictGzipWriter writes gzip formatted data that is compressed using a preset
+// deflate dictionary. The stdlib gzip package does not support dictionaries,
+// so the gzip framing is written here around a flate writer.
+//
+// Data written this way can only be decompressed by a reader that uses the
+// same dictionary.
+type dictGzipWriter struct {
+	w    io.Writer
+	fw   *flate.Writer
+	crc  hash.Hash32
+	size uint32
+}
+
+func newDictGzipWriter(w io.Writer, level int, dict []byte, modTime time.Time) (*dictGzipWriter, error) {
+	// Header: magic, deflate method, no flags, mtime, no extra flags, unknown
+	// OS.
+	hdr := [10]byte{gzipMagic[0], gzipMagic[1], 8, 0, 0, 0, 0, 0, 0, 255}
+	if !modTime.IsZero() && modTime.After(time.Unix(0, 0)) {
+		binary.LittleEndian.PutUint32(hdr[4:8], uint32(modTime.Unix()))
+	}
+	if _, err := w.Write(hdr[:]); err != nil {
+		return nil, err
+	}
+	fw, err := flate.NewWriterDict(w, level, dict)
+	if err != nil {
+		return nil, err
+	}
+	return &dictGzipWriter{
+		w:   w,
+		fw:  fw,
+		crc: crc32.NewIEEE(),
+	}, nil
+}
+
+func (z *dictGzipWriter) Write(p []byte) (int, error) {
+	z.crc.Write(p)
+	z.size += uint32(len(p))
+	return z.fw.Write(p)
+}
+
+// Close finishes writing the compressed data and writes the gzip trailer. It
+// does not close the underlying writer.
+func (z *dictGzipWriter) Close() error {
+	if err := z.fw.Close(); err != nil {
+		return err
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], z.crc.Sum32())
+	binary.LittleEndian.PutUint32(trailer[4:], z.size)
+	_, err := z.w.Write(trailer[:])
+	return err
+}
+
+// dictGzipReader reads gzip formatted data that was compressed using a preset
+// deflate dictionary.
+type dictGzipReader struct {
+	r    *bufio.Reader
+	fr   io.ReadCloser
+	crc  hash.Hash32
+	size uint32
+}
+
+func newDictGzipReader(r *bufio.Reader, dict []byte) (*dictGzipReader, error) {
+	var hdr [10]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != gzipMagic[0] || hdr[1] != gzipMagic[1] || hdr[2] != 8 {
+		return nil, gzip.ErrHeader
+	}
+	flags := hdr[3]
+	if flags&gzipFlagExtra != 0 {
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			return nil, err
+		}
+		n := int64(binary.LittleEndian.Uint16(lenBuf[:]))
+		if _, err := io.CopyN(io.Discard, r, n); err != nil {
+			return nil, err
+		}
+	}
+	for _, flag := range []byte{gzipFlagName, gzipFlagComment} {
+		if flags&flag != 0 {
+			if _, err := r.ReadBytes(0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if flags&gzipFlagHdrCRC != 0 {
+		if _, err := io.CopyN(io.Discard, r, 2); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dictGzipReader{
+		r:   r,
+		fr:  flate.NewReaderDict(r, dict),
+		crc: crc32.NewIEEE(),
+	}, nil
+}
+
+func (z *dictGzipReader) Read(p []byte) (int, error) {
+	n, err := z.fr.Read(p)
+	z.crc.Write(p[:n])
+	z.size += uint32(n)
+	if err != io.EOF {
+		return n, err
+	}
+
+	// End of compressed data; verify trailer.
+	var trailer [8]byte
+	if _, err = io.ReadFull(z.r, trailer[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+	if binary.LittleEndian.Uint32(trailer[:4]) != z.crc.Sum32() ||
+		binary.LittleEndian.Uint32(trailer[4:]) != z.size {
+		return n, gzip.ErrChecksum
+	}
+	return n, io.EOF
+}
+
+func (z *dictGzipReader) Close() error {
+	return z.fr.Close()
+}
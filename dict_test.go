@@ -0,0 +1,45 @@
+package targz_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionDict(t *testing.T) {
+	const template = `{"service": "%s", "enabled": true, "timeout_seconds": 30, ` +
+		`"retries": 5, "endpoints": ["https://api.example.com/v1/status", ` +
+		`"https://api.example.com/v1/health"], "owner": "platform-team"}`
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "configs")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	for _, name := range []string{"auth", "billing", "search"} {
+		data := fmt.Sprintf(template, name)
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name+".json"), []byte(data), 0640))
+	}
+	dict := []byte(fmt.Sprintf(template, "example"))
+
+	var plain, withDict bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &plain))
+	require.NoError(t, targz.CreateWriter(srcDir, &withDict, targz.WithCompressionDict(dict)))
+	require.Less(t, withDict.Len(), plain.Len())
+
+	outDir := t.TempDir()
+	err := targz.ExtractReader(bytes.NewReader(withDict.Bytes()), outDir, targz.WithCompressionDict(dict))
+	require.NoError(t, err)
+	for _, name := range []string{"auth", "billing", "search"} {
+		data, err := os.ReadFile(filepath.Join(outDir, "configs", name+".json"))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf(template, name), string(data))
+	}
+
+	// Extraction without the dictionary fails.
+	err = targz.ExtractReader(bytes.NewReader(withDict.Bytes()), t.TempDir())
+	require.Error(t, err)
+}
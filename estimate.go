@@ -0,0 +1,55 @@
+package targz
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// EstimateRatio estimates how much the files in dir compress, by compressing a
+// sample of up to sampleBytes of file data. The sample is taken from the start
+// of each file, in the order that files are archived, until the sample is
+// complete. The data is compressed at the level set by WithCompressionLevel,
+// so that the ratio of different levels can be compared before creating the
+// archive.
+//
+// The returned ratio is the sample size divided by its compressed size. If
+// there is no file data to sample, then the ratio is 0.
+func EstimateRatio(dir string, sampleBytes int64, options ...Option) (float64, error) {
+	opts := getOpts(options)
+	parent, dir, err := splitParent(opts.resolvePath(dir))
+	if err != nil {
+		return 0, err
+	}
+
+	var compressed bytes.Buffer
+	gzw, err := gzip.NewWriterLevel(&compressed, opts.level())
+	if err != nil {
+		return 0, err
+	}
+	var sampled int64
+	err = walkDir(parent, dir, &opts, func(e archiveEntry) error {
+		if !e.info.Mode().IsRegular() || sampled >= sampleBytes {
+			return nil
+		}
+		f, err := os.Open(e.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := io.Copy(gzw, io.LimitReader(f, sampleBytes-sampled))
+		sampled += n
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err = gzw.Close(); err != nil {
+		return 0, err
+	}
+	if sampled == 0 {
+		return 0, nil
+	}
+	return float64(sampled) / float64(compressed.Len()), nil
+}
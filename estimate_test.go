@@ -0,0 +1,48 @@
+package targz_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateRatio(t *testing.T) {
+	tmpDir := t.TempDir()
+	textDir := filepath.Join(tmpDir, "text")
+	require.NoError(t, os.MkdirAll(filepath.Join(textDir, "sub"), 0750))
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 10000)
+	require.NoError(t, os.WriteFile(filepath.Join(textDir, "a.txt"), text, 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(textDir, "sub", "b.txt"), text, 0640))
+
+	randomDir := filepath.Join(tmpDir, "random")
+	require.NoError(t, os.Mkdir(randomDir, 0750))
+	random := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	require.NoError(t, os.WriteFile(filepath.Join(randomDir, "r.bin"), random, 0640))
+
+	textRatio, err := targz.EstimateRatio(textDir, 64*1024)
+	require.NoError(t, err)
+	require.Greater(t, textRatio, 10.0)
+
+	randomRatio, err := targz.EstimateRatio(randomDir, 64*1024)
+	require.NoError(t, err)
+	require.Less(t, randomRatio, 1.01)
+
+	// Level affects ratio.
+	storedRatio, err := targz.EstimateRatio(textDir, 64*1024, targz.WithCompressionLevel(gzip.NoCompression))
+	require.NoError(t, err)
+	require.Less(t, storedRatio, 1.0)
+
+	// No data to sample.
+	emptyDir := filepath.Join(tmpDir, "empty")
+	require.NoError(t, os.Mkdir(emptyDir, 0750))
+	ratio, err := targz.EstimateRatio(emptyDir, 64*1024)
+	require.NoError(t, err)
+	require.Zero(t, ratio)
+}
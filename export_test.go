@@ -0,0 +1,34 @@
+package targz
+
+import "time"
+
+// SetCompressBlock replaces the function used by the parallel compressor to
+// compress each block, and returns a function that restores the original.
+func SetCompressBlock(f func(block []byte, level int, modTime time.Time) ([]byte, error)) func() {
+	orig := compressBlock
+	compressBlock = f
+	return func() {
+		compressBlock = orig
+	}
+}
+
+// CompressBlock is the original function used by the parallel compressor to
+// compress each block.
+var CompressBlock = compressBlock
+
+// RestoreLinkTime sets the times of a symbolic link without following it.
+var RestoreLinkTime = restoreLinkTime
+
+// PermSetter sets the permissions and ownership of extracted files.
+type PermSetter = permSetter
+
+// SetPermSetter replaces the PermSetter used to set the owner of extracted
+// files and by the permission fix pass, and returns a function that restores
+// the original.
+func SetPermSetter(s PermSetter) func() {
+	orig := perms
+	perms = s
+	return func() {
+		perms = orig
+	}
+}
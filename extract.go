@@ -0,0 +1,813 @@
+package targz
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTruncatedArchive is returned when archive data ends before the end of
+// the archive is reached.
+var ErrTruncatedArchive = errors.New("archive is truncated")
+
+// ErrDuplicateEntry is returned when an archive contains more than one entry
+// with the same name, and duplicates are rejected.
+var ErrDuplicateEntry = errors.New("duplicate archive entry")
+
+// ErrChecksumMismatch is returned when the content of an extracted file does
+// not match the checksum recorded in the archive.
+var ErrChecksumMismatch = errors.New("file checksum does not match archive")
+
+// ErrOutsideTarget is returned when an archive entry would be extracted to a
+// location outside of the target directory.
+var ErrOutsideTarget = errors.New("entry is outside of target directory")
+
+// ErrEscapingLink is returned when a symbolic link in an archive refers to a
+// location outside of the target directory, and such links are not allowed.
+var ErrEscapingLink = errors.New("symbolic link target is outside of target directory")
+
+// extractor writes archive entries into a target directory.
+type extractor struct {
+	targetDir string
+	opts      *config
+	openFile  fileOpenerFunc
+	isRoot    bool
+
+	// Number of entries extracted.
+	count int
+	// Paths planned to be created, when planning instead of extracting.
+	planned map[string]struct{}
+	// Paths of entries already processed, when rejecting duplicates.
+	seen map[string]struct{}
+	// Archive names of the directories containing the current entry, from
+	// outermost to innermost, when reporting completed directories.
+	openDirs []string
+	// Entries written to the quarantine directory.
+	quarantined []QuarantinedEntry
+	// Directory entries not yet created, by target path, when creating
+	// directories lazily.
+	pendingDirs map[string]*tar.Header
+	// Permissions to apply to extracted entries after all are written.
+	permFixes []permFix
+	// Counts bytes of file data extracted, when reporting progress.
+	progress *progressCounter
+	// Symbolic links to replace by copies of their targets.
+	pendingLinks []pendingLink
+	// Modification times to set on directories after all entries are
+	// extracted.
+	dirTimes []dirTime
+	// Directories created as parents of entries that came before the
+	// directories' own entries.
+	implicitDirs map[string]struct{}
+	// Bytes of file data extracted, when limiting the total size.
+	extracted *atomic.Int64
+	// Target directory with symbolic links resolved.
+	resolvedTarget string
+}
+
+// dirTime is the modification time of an extracted directory.
+type dirTime struct {
+	path    string
+	modTime time.Time
+}
+
+func newExtractor(targetDir string, opts *config) *extractor {
+	if targetDir == "" {
+		targetDir = "."
+	}
+	openFile := opts.fileOpener
+	if openFile == nil {
+		openFile = createFile
+	}
+	x := &extractor{
+		targetDir: targetDir,
+		opts:      opts,
+		openFile:  openFile,
+		isRoot:    os.Getuid() == 0,
+	}
+	if opts.rejectDuplicates {
+		x.seen = map[string]struct{}{}
+	}
+	if opts.lazyDirs {
+		x.pendingDirs = map[string]*tar.Header{}
+	}
+	if opts.maxSize > 0 {
+		x.extracted = &atomic.Int64{}
+	}
+	if opts.progressFunc != nil {
+		x.progress = &progressCounter{
+			total:  -1,
+			report: opts.progressFunc,
+		}
+	}
+	return x
+}
+
+// readError returns ErrTruncatedArchive, with the number of entries extracted,
+// if err indicates that the archive data ended unexpectedly. Otherwise err is
+// returned.
+func (x *extractor) readError(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: data ended after %d entries extracted", ErrTruncatedArchive, x.count)
+	}
+	return err
+}
+
+// extractEntry extracts the entry described by header, reading any file data
+// from r.
+func (x *extractor) extractEntry(header *tar.Header, r io.Reader) error {
+	target, write, err := x.prepareEntry(header, r)
+	if err != nil || !write {
+		return err
+	}
+	return x.writeEntry(header, target, r)
+}
+
+// prepareEntry checks the entry described by header, and returns the target
+// path to write the entry to. If the entry is not to be written, because it
+// is skipped, quarantined, or deferred, then false is returned.
+func (x *extractor) prepareEntry(header *tar.Header, r io.Reader) (string, bool, error) {
+	if x.opts.quarantineDir != "" {
+		if reason := unsafeReason(header, x.opts.allowEscapingLinks); reason != "" {
+			return "", false, x.quarantine(header, r, reason)
+		}
+	}
+
+	plan, err := x.planEntry(header)
+	if err != nil {
+		return "", false, err
+	}
+	if plan.Action == ActionSkip {
+		return "", false, nil
+	}
+	// Links that replace directories are removed, instead of followed, when
+	// using rooted extraction.
+	if !x.opts.rootedExtraction {
+		if err = x.checkResolved(header, plan.Path); err != nil {
+			return "", false, err
+		}
+	}
+	if x.pendingDirs != nil {
+		if isDirEntry(header) {
+			// Create the directory when something is written in it.
+			x.pendingDirs[plan.Path] = header
+			return "", false, nil
+		}
+		if err = x.makePendingDirs(filepath.Dir(plan.Path)); err != nil {
+			return "", false, err
+		}
+	}
+	return plan.Path, true, nil
+}
+
+// writeEntry writes the entry described by header to the target path, reading
+// any file data from r.
+func (x *extractor) writeEntry(header *tar.Header, target string, r io.Reader) error {
+	uid := -1
+	gid := -1
+	if x.isRoot {
+		if header.Uname != "" {
+			usr, err := user.Lookup(header.Uname)
+			// Ignore error; user not on this host.
+			if err == nil {
+				uid, err = strconv.Atoi(usr.Uid)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if header.Gname != "" {
+			grp, err := user.LookupGroup(header.Gname)
+			// Ignore error; group not on this host.
+			if err == nil {
+				gid, err = strconv.Atoi(grp.Gid)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	mode := x.opts.extractMode(header)
+
+	// Create parent directories, in case the archive does not contain entries
+	// for them or they come after the entries they contain.
+	if x.opts.rootedExtraction {
+		if err := x.makeRootedDirs(filepath.Dir(target)); err != nil {
+			return err
+		}
+		// Do not write through an existing link at the target.
+		if err := removeSymlink(target); err != nil {
+			return err
+		}
+	} else if err := x.makeParentDirs(filepath.Dir(target)); err != nil {
+		return err
+	}
+
+	if header.Typeflag == tar.TypeLink {
+		linkTarget := filepath.Join(x.targetDir, filepath.FromSlash(header.Linkname))
+		if err := extractLink(linkTarget, target, mode.Perm(), x.opts.copyLinks, x.openFile); err != nil {
+			return err
+		}
+	} else if header.Typeflag == tar.TypeSymlink {
+		if !x.opts.allowEscapingLinks && symlinkEscapes(header.Name, header.Linkname) {
+			return fmt.Errorf("%w: %s links to %s", ErrEscapingLink, header.Name, header.Linkname)
+		}
+		if x.opts.materializeSymlinks {
+			// Copy target after all entries are extracted.
+			x.pendingLinks = append(x.pendingLinks, pendingLink{
+				header: header,
+				target: target,
+			})
+			return nil
+		}
+		// Remove any existing file, since a link cannot replace it.
+		if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return err
+		}
+		if err := x.chown(target, uid, gid); err != nil {
+			return err
+		}
+		if !x.opts.skipRestoreTimes {
+			if err := restoreLinkTime(target, header.ModTime); err != nil {
+				return err
+			}
+		}
+	} else if isDirEntry(header) {
+		if err := os.Mkdir(target, mode.Perm()); err != nil {
+			if _, ok := x.implicitDirs[target]; !ok || !errors.Is(err, os.ErrExist) {
+				return err
+			}
+			// Directory was created for an earlier entry, so apply the
+			// permissions of its own entry.
+			delete(x.implicitDirs, target)
+			if err = os.Chmod(target, mode.Perm()); err != nil {
+				return err
+			}
+		}
+		if err := x.chown(target, uid, gid); err != nil {
+			return err
+		}
+		if !x.opts.skipRestoreTimes {
+			// Set time after directory contents are written.
+			x.dirTimes = append(x.dirTimes, dirTime{
+				path:    target,
+				modTime: header.ModTime,
+			})
+		}
+	} else if mode.IsRegular() {
+		var err error
+		if x.opts.maxFileRatio > 0 && x.opts.compressed != nil {
+			r = &ratioReader{
+				r:          r,
+				name:       header.Name,
+				compressed: x.opts.compressed,
+				start:      x.opts.compressed.n,
+				maxRatio:   x.opts.maxFileRatio,
+			}
+		}
+		if x.opts.maxSize > 0 || x.opts.maxFileSize > 0 {
+			r = &sizeLimitReader{
+				r:        r,
+				name:     header.Name,
+				maxFile:  x.opts.maxFileSize,
+				maxTotal: x.opts.maxSize,
+				total:    x.extracted,
+			}
+		}
+		if x.progress != nil {
+			x.progress.startFile(header.Name)
+			r = &progressReader{r: r, progress: x.progress}
+		}
+		// Hash the file data, as read from the archive, to verify checksum.
+		var h hash.Hash
+		wantSum, hasSum := header.PAXRecords[paxSHA256]
+		if hasSum && x.opts.verifyChecksums {
+			h = sha256.New()
+			r = io.TeeReader(r, h)
+		}
+		if x.opts.extractTransform != nil {
+			r = x.opts.extractTransform(header.Name, r)
+		}
+		if x.opts.matchHash != nil {
+			var same bool
+			r, same, err = x.matchExisting(target, header.Size, r)
+			if err != nil {
+				return err
+			}
+			if same {
+				// Existing file already has the content.
+				if x.progress != nil {
+					x.progress.finishFile(header.Size)
+				}
+				return nil
+			}
+		}
+
+		var f io.WriteCloser
+		var deadline time.Time
+		if x.opts.entryTimeout > 0 {
+			deadline = time.Now().Add(x.opts.entryTimeout)
+			f, err = openBefore(deadline, x.openFile, target, mode.Perm())
+		} else {
+			f, err = x.openFile(target, mode.Perm())
+		}
+		if err != nil {
+			return x.timeoutError(header.Name, target, err)
+		}
+		if hf, ok := f.(holeFile); ok && x.opts.detectHoles {
+			f = &holeWriter{f: hf}
+		}
+		if !deadline.IsZero() {
+			f = &timeoutWriter{w: f, deadline: deadline}
+		}
+		if _, err = copyContext(x.opts.ctx, f, r); err != nil {
+			f.Close()
+			if errors.Is(err, ErrMaxSize) || errors.Is(err, ErrFileRatio) {
+				// Do not leave partial file in place.
+				_ = os.Remove(target)
+				return err
+			}
+			return x.timeoutError(header.Name, target, err)
+		}
+		if err = f.Close(); err != nil {
+			return x.timeoutError(header.Name, target, err)
+		}
+		if x.progress != nil {
+			x.progress.finishFile(header.Size)
+		}
+
+		if h != nil && hex.EncodeToString(h.Sum(nil)) != wantSum {
+			// Do not leave file with bad content in place.
+			if err = os.Remove(target); err != nil {
+				return err
+			}
+			err = fmt.Errorf("%w: %s", ErrChecksumMismatch, header.Name)
+			if x.opts.skipBadChecksums {
+				x.opts.warn(err.Error())
+				return nil
+			}
+			return err
+		}
+
+		if err = x.chown(target, uid, gid); err != nil {
+			return err
+		}
+
+		// Set capabilities after chown, since chown clears them.
+		if capData, ok := header.PAXRecords[paxCapability]; ok && x.opts.capabilities {
+			if err = setCapability(target, []byte(capData)); err != nil {
+				return fmt.Errorf("cannot set capabilities on %s: %w", target, err)
+			}
+		}
+		if !x.opts.skipRestoreTimes {
+			if err = restoreTime(target, header.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+	if x.opts.postFixPerms {
+		x.permFixes = append(x.permFixes, permFix{
+			path:    target,
+			perm:    mode.Perm(),
+			uid:     uid,
+			gid:     gid,
+			symlink: header.Typeflag == tar.TypeSymlink,
+		})
+	}
+	if x.opts.stats != nil {
+		x.opts.stats.add(header)
+	}
+	x.count++
+	return nil
+}
+
+// chown sets the owner of the extracted entry at target, without following a
+// symbolic link, if a uid or gid is given. Failure is ignored, since it may not
+// be allowed on NAS, unless WithStrictChown is enabled.
+func (x *extractor) chown(target string, uid, gid int) error {
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+	if err := perms.Lchown(target, uid, gid); err != nil && x.opts.strictChown {
+		return fmt.Errorf("cannot set owner of %s: %w", target, err)
+	}
+	return nil
+}
+
+// makeParentDirs creates the directory dir and any missing parents. The
+// directories created within the target directory are recorded, so that a
+// directory entry that comes after the entries it contains is still applied.
+func (x *extractor) makeParentDirs(dir string) error {
+	root := filepath.Clean(x.targetDir)
+	for d := dir; d != root && x.withinTarget(d); d = filepath.Dir(d) {
+		if _, err := os.Lstat(d); !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if x.implicitDirs == nil {
+			x.implicitDirs = map[string]struct{}{}
+		}
+		x.implicitDirs[d] = struct{}{}
+	}
+	return os.MkdirAll(dir, x.defaultDirMode())
+}
+
+// finish completes the work deferred until all entries are extracted:
+// materializing symbolic links, fixing permissions, and setting directory
+// times.
+func (x *extractor) finish() error {
+	if x.opts.materializeSymlinks {
+		if err := x.materializeLinks(); err != nil {
+			return err
+		}
+	}
+	if x.opts.postFixPerms {
+		if err := x.fixPermissions(); err != nil {
+			return err
+		}
+	}
+	return x.restoreDirTimes()
+}
+
+// restoreDirTimes sets the modification time of each extracted directory,
+// deepest first, after all entries are written.
+func (x *extractor) restoreDirTimes() error {
+	sortDeepestFirst(x.dirTimes)
+	for _, dt := range x.dirTimes {
+		if err := restoreTime(dt.path, dt.modTime); err != nil {
+			return err
+		}
+	}
+	x.dirTimes = nil
+	return nil
+}
+
+// sortDeepestFirst sorts directory times so that each directory comes before
+// the directory that contains it. The order of directories at the same depth is
+// kept.
+func sortDeepestFirst(dirTimes []dirTime) {
+	sort.SliceStable(dirTimes, func(i, j int) bool {
+		return pathDepth(dirTimes[i].path) > pathDepth(dirTimes[j].path)
+	})
+}
+
+// pathDepth returns the number of path elements in the cleaned path p.
+func pathDepth(p string) int {
+	return strings.Count(filepath.ToSlash(filepath.Clean(p)), "/")
+}
+
+// restoreTime sets the access and modification times of the file at path to
+// modTime. A file that does not exist, because a custom file opener did not
+// write to the path, is ignored.
+func restoreTime(path string, modTime time.Time) error {
+	if modTime.IsZero() {
+		return nil
+	}
+	err := os.Chtimes(path, modTime, modTime)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// makePendingDirs creates dir, and the directories that contain it, from any
+// directory entries that have not yet been created.
+func (x *extractor) makePendingDirs(dir string) error {
+	var dirs []string
+	for dir != x.targetDir && x.withinTarget(dir) {
+		dirs = append(dirs, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	// Create outermost directories first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		header, ok := x.pendingDirs[dirs[i]]
+		if !ok {
+			continue
+		}
+		delete(x.pendingDirs, dirs[i])
+		if err := x.writeEntry(header, dirs[i], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackDirs updates the directories that contain the current entry, and
+// reports each directory that the sequence of entries has left as complete.
+func (x *extractor) trackDirs(header *tar.Header) {
+	dir := path.Clean(header.Name)
+	if !isDirEntry(header) {
+		dir = path.Dir(dir)
+	}
+	for len(x.openDirs) != 0 {
+		last := x.openDirs[len(x.openDirs)-1]
+		if dir == last || strings.HasPrefix(dir, last+"/") {
+			break
+		}
+		x.closeDir()
+	}
+	if dir == "." || dir == "/" {
+		return
+	}
+	parts := strings.Split(dir, "/")
+	for i := len(x.openDirs); i < len(parts); i++ {
+		x.openDirs = append(x.openDirs, strings.Join(parts[:i+1], "/"))
+	}
+}
+
+// closeDir reports the innermost open directory as complete.
+func (x *extractor) closeDir() {
+	last := x.openDirs[len(x.openDirs)-1]
+	x.openDirs = x.openDirs[:len(x.openDirs)-1]
+	x.opts.dirCompleteHook(filepath.Join(x.targetDir, filepath.FromSlash(last)))
+}
+
+// finishDirs reports all remaining open directories as complete.
+func (x *extractor) finishDirs() {
+	for len(x.openDirs) != 0 {
+		x.closeDir()
+	}
+}
+
+// makeRootedDirs creates the directories from the target directory down to
+// dir. Any symbolic link in the path is replaced by a real directory, so that
+// nothing is created through a link that points elsewhere, including outside
+// of the target directory or back into it.
+func (x *extractor) makeRootedDirs(dir string) error {
+	rel, err := filepath.Rel(x.targetDir, dir)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("directory %s is outside of target directory", dir)
+	}
+	cur := x.targetDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		if err = removeSymlink(cur); err != nil {
+			return err
+		}
+		err = os.Mkdir(cur, x.defaultDirMode())
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSymlink removes the file at path if it is a symbolic link.
+func removeSymlink(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// defaultDirMode returns the permissions for directories that are created
+// implicitly, not from an archive entry.
+func (x *extractor) defaultDirMode() os.FileMode {
+	if x.opts.defaultDirMode != 0 {
+		return x.opts.defaultDirMode
+	}
+	return defaultDirMode
+}
+
+// planEntry determines the action that extracting the entry takes. This is
+// used both to extract entries and to report what extraction would do.
+func (x *extractor) planEntry(header *tar.Header) (PlanEntry, error) {
+	// Convert archive path separators to the OS separator.
+	target := filepath.Join(x.targetDir, filepath.FromSlash(header.Name))
+	plan := PlanEntry{
+		Name: header.Name,
+		Path: target,
+	}
+	if !x.withinTarget(target) {
+		return plan, fmt.Errorf("%w: entry %q", ErrOutsideTarget, header.Name)
+	}
+	if header.Typeflag == tar.TypeLink {
+		linkTarget := filepath.Join(x.targetDir, filepath.FromSlash(header.Linkname))
+		if !x.withinTarget(linkTarget) {
+			return plan, fmt.Errorf("%w: entry %q links to %q", ErrOutsideTarget, header.Name, header.Linkname)
+		}
+	}
+
+	if x.seen != nil {
+		if _, found := x.seen[target]; found {
+			return plan, fmt.Errorf("%w: %s", ErrDuplicateEntry, header.Name)
+		}
+		x.seen[target] = struct{}{}
+	}
+
+	mode := header.FileInfo().Mode()
+	isDir := isDirEntry(header)
+	if header.Typeflag != tar.TypeLink && header.Typeflag != tar.TypeSymlink && !isDir && !mode.IsRegular() {
+		// Other types of entries are not extracted.
+		plan.Action = ActionSkip
+		return plan, nil
+	}
+
+	exists, err := x.exists(target)
+	if err != nil {
+		return plan, err
+	}
+	_, implicit := x.implicitDirs[target]
+	switch {
+	case !exists:
+		plan.Action = ActionCreate
+	case isDir && implicit:
+		// Directory created for an earlier entry gets this entry's metadata.
+		plan.Action = ActionOverwrite
+	case isDir:
+		// Existing directory, or file, is left as is.
+		plan.Action = ActionSkip
+	case x.opts.overwrite == OverwriteSkip:
+		plan.Action = ActionSkip
+	case x.opts.overwrite == OverwriteFail:
+		return plan, fmt.Errorf("cannot extract %s: %w", target, os.ErrExist)
+	default:
+		plan.Action = ActionOverwrite
+	}
+
+	if x.planned != nil && plan.Action == ActionCreate {
+		x.planned[target] = struct{}{}
+	}
+	return plan, nil
+}
+
+// selectEntry returns true if the entry is extracted. Any leading name
+// elements to strip are removed from the header's names.
+func (c *config) selectEntry(hdr *tar.Header) bool {
+	if c.stripCount > 0 {
+		name, ok := stripComponents(hdr.Name, c.stripCount)
+		if !ok {
+			return false
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			linkname, ok := stripComponents(hdr.Linkname, c.stripCount)
+			if !ok {
+				c.warn(fmt.Sprintf("skipping %s: link target %s is stripped", hdr.Name, hdr.Linkname))
+				return false
+			}
+			hdr.Linkname = linkname
+		}
+		hdr.Name = name
+	}
+	return c.extractFilter == nil || c.extractFilter(hdr)
+}
+
+// stripComponents removes the first n slash-separated elements of name.
+// Returns false if name has no more than n elements.
+func stripComponents(name string, n int) (string, bool) {
+	elems := strings.Split(strings.Trim(name, "/"), "/")
+	if len(elems) <= n {
+		return "", false
+	}
+	stripped := strings.Join(elems[n:], "/")
+	if strings.HasSuffix(name, "/") {
+		stripped += "/"
+	}
+	return stripped, true
+}
+
+// isDirEntry returns true if the entry is a directory. Old V7 format archives
+// have no directory type, and instead identify directories by a trailing slash
+// on the name of a regular file entry.
+func isDirEntry(header *tar.Header) bool {
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return true
+	case tar.TypeReg, tar.TypeRegA:
+		return strings.HasSuffix(header.Name, "/")
+	}
+	return false
+}
+
+// withinTarget returns true if the path, made by joining a name to the target
+// directory, is within the target directory.
+func (x *extractor) withinTarget(target string) bool {
+	return withinDir(x.targetDir, target)
+}
+
+// withinDir returns true if the path p is dir or is within dir.
+func withinDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// exists returns true if the target path exists. When planning, a path that
+// a previous entry is planned to create is considered to exist.
+func (x *extractor) exists(target string) (bool, error) {
+	if _, found := x.planned[target]; found {
+		return true, nil
+	}
+	_, err := os.Lstat(target)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// symlinkEscapes returns true if the target of a symbolic link, named name in
+// an archive, is absolute or refers outside of the archive root.
+func symlinkEscapes(name, linkname string) bool {
+	if linkname == "" || path.IsAbs(filepath.ToSlash(linkname)) || filepath.IsAbs(linkname) ||
+		filepath.VolumeName(linkname) != "" {
+		return true
+	}
+	resolved := path.Join(path.Dir(path.Clean(name)), filepath.ToSlash(linkname))
+	return resolved == ".." || strings.HasPrefix(resolved, "../")
+}
+
+// extractLink creates target as a hard link to the previously extracted
+// linkTarget, or as a copy of linkTarget if copyFile is true.
+func extractLink(linkTarget, target string, perm os.FileMode, copyFile bool, openFile fileOpenerFunc) error {
+	// Remove any existing file, since a link cannot replace it.
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if !copyFile {
+		return os.Link(linkTarget, target)
+	}
+
+	src, err := os.Open(linkTarget)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := openFile(target, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// cleanDir removes everything within dir, leaving dir empty. Only entries
+// within dir are removed; symbolic links are removed without following them. A
+// dir that does not exist is not an error.
+func cleanDir(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if filepath.Dir(absDir) == absDir {
+		return fmt.Errorf("cannot clean root directory %s", absDir)
+	}
+	entries, err := os.ReadDir(absDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, de := range entries {
+		if err = os.RemoveAll(filepath.Join(absDir, de.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createFile is the default file opener used to write extracted files.
+func createFile(name string, mode os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode)
+}
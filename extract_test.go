@@ -0,0 +1,788 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractTruncated(t *testing.T) {
+	const fileSize = 8192
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	rnd := rand.New(rand.NewSource(3))
+	for i := 0; i < 10; i++ {
+		data := make([]byte, fileSize)
+		rnd.Read(data)
+		name := filepath.Join(srcDir, fmt.Sprintf("file%d", i))
+		require.NoError(t, os.WriteFile(name, data, 0640))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	truncated := buf.Bytes()[:buf.Len()/2]
+
+	outDir := t.TempDir()
+	err := targz.ExtractReader(bytes.NewReader(truncated), outDir)
+	require.ErrorIs(t, err, targz.ErrTruncatedArchive)
+
+	// Count the entries that were completely extracted.
+	var complete int
+	err2 := filepath.Walk(outDir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != outDir && (fi.IsDir() || fi.Size() == fileSize) {
+			complete++
+		}
+		return nil
+	})
+	require.NoError(t, err2)
+	require.Greater(t, complete, 1)
+	require.Less(t, complete, 11)
+	require.ErrorContains(t, err, fmt.Sprintf("after %d entries", complete))
+}
+
+func TestDefaultDirMode(t *testing.T) {
+	// Archive without directory entries.
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, targz.WriteFile(tw, "top/mid/file.txt", []byte("data"), 0640, time.Now()))
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     "top/explicit/",
+		Mode:     0750,
+	}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	archive := buf.Bytes()
+
+	checkModes := func(outDir string, implicit os.FileMode) {
+		for _, dir := range []string{"top", "top/mid"} {
+			fi, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(dir)))
+			require.NoError(t, err)
+			require.Equal(t, implicit, fi.Mode().Perm(), dir)
+		}
+		fi, err := os.Stat(filepath.Join(outDir, "top", "explicit"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0750), fi.Mode().Perm())
+	}
+
+	// Explicit mode.
+	outDir := t.TempDir()
+	err := targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithDefaultDirMode(0700))
+	require.NoError(t, err)
+	checkModes(outDir, 0700)
+
+	// Default mode, subject to umask.
+	outDir = t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir))
+	fi, err := os.Stat(filepath.Join(outDir, "top"))
+	require.NoError(t, err)
+	require.Zero(t, fi.Mode().Perm()&^0755)
+	require.Equal(t, os.FileMode(0700), fi.Mode().Perm()&0700)
+}
+
+func TestExtractFileBeforeDir(t *testing.T) {
+	// Archive with files before their directory entries, and without an entry
+	// for the top directory.
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, targz.WriteFile(tw, "top/sub/deep/file.txt", []byte("data"), 0640, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "top/sub/other.txt", []byte("other"), 0640, time.Now()))
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     "top/sub/",
+		Mode:     0750,
+	}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir, targz.WithDefaultDirMode(0700)))
+	data, err := os.ReadFile(filepath.Join(outDir, "top", "sub", "deep", "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "data", string(data))
+	data, err = os.ReadFile(filepath.Join(outDir, "top", "sub", "other.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "other", string(data))
+
+	// Directory entry that came after its contents is still applied.
+	fi, err := os.Stat(filepath.Join(outDir, "top", "sub"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0750), fi.Mode().Perm())
+	fi, err = os.Stat(filepath.Join(outDir, "top"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+}
+
+func TestExtractContentTransform(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello world"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("Mixed Case"), 0640))
+
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	var names []string
+	upper := func(name string, r io.Reader) io.Reader {
+		names = append(names, name)
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return iotest.ErrReader(err)
+		}
+		return bytes.NewReader(bytes.ToUpper(data))
+	}
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithExtractContentTransform(upper)))
+	require.Equal(t, []string{"src/a.txt", "src/b.txt"}, names)
+
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "HELLO WORLD", string(data))
+	data, err = os.ReadFile(filepath.Join(outDir, "src", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "MIXED CASE", string(data))
+}
+
+func TestRejectDuplicates(t *testing.T) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, targz.WriteFile(tw, "dir/file.txt", []byte("first"), 0640, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "dir/other.txt", []byte("other"), 0640, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "dir/./file.txt", []byte("second"), 0640, time.Now()))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	archive := buf.Bytes()
+
+	// Without option, later entry overwrites earlier.
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "dir", "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "second", string(data))
+
+	outDir = t.TempDir()
+	err = targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithRejectDuplicates(true))
+	require.ErrorIs(t, err, targz.ErrDuplicateEntry)
+	require.ErrorContains(t, err, "dir/file.txt")
+	data, err = os.ReadFile(filepath.Join(outDir, "dir", "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "first", string(data))
+}
+
+func TestExtractV7(t *testing.T) {
+	var v7 bytes.Buffer
+	writeV7Entry(t, &v7, "v7/", 0755, '0', nil)
+	writeV7Entry(t, &v7, "v7/sub/", 0750, 0, nil)
+	writeV7Entry(t, &v7, "v7/sub/file.txt", 0640, 0, []byte("hello v7"))
+	writeV7Entry(t, &v7, "v7/other.txt", 0600, '0', []byte("other"))
+	v7.Write(make([]byte, 2*512))
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	_, err := gzw.Write(v7.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(buf.Bytes()), outDir))
+
+	fi, err := os.Stat(filepath.Join(outDir, "v7", "sub"))
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+	data, err := os.ReadFile(filepath.Join(outDir, "v7", "sub", "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello v7", string(data))
+	data, err = os.ReadFile(filepath.Join(outDir, "v7", "other.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "other", string(data))
+
+	tarPath := filepath.Join(t.TempDir(), "v7.tar.gz")
+	require.NoError(t, os.WriteFile(tarPath, buf.Bytes(), 0644))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+}
+
+// writeV7Entry writes a pre-USTAR V7 format header, followed by data, to w.
+func writeV7Entry(t *testing.T, w io.Writer, name string, mode int64, typeflag byte, data []byte) {
+	var hdr [512]byte
+	copy(hdr[0:100], name)
+	copy(hdr[100:108], fmt.Sprintf("%07o", mode))
+	copy(hdr[108:116], fmt.Sprintf("%07o", 0))
+	copy(hdr[116:124], fmt.Sprintf("%07o", 0))
+	copy(hdr[124:136], fmt.Sprintf("%011o", len(data)))
+	copy(hdr[136:148], fmt.Sprintf("%011o", time.Now().Unix()))
+	hdr[156] = typeflag
+	copy(hdr[148:156], "        ")
+	var sum int64
+	for _, b := range hdr {
+		sum += int64(b)
+	}
+	copy(hdr[148:156], fmt.Sprintf("%06o\x00 ", sum))
+
+	_, err := w.Write(hdr[:])
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	if pad := len(data) % 512; pad != 0 {
+		_, err = w.Write(make([]byte, 512-pad))
+		require.NoError(t, err)
+	}
+}
+
+func TestDirCompleteHook(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	files := []string{"a.txt", "sub/b.txt", "sub/deep/c.txt", "sub/deep/d.txt", "other/e.txt"}
+	for _, name := range files {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	outDir := t.TempDir()
+	complete := map[string]bool{}
+	hook := func(dir string) {
+		require.False(t, complete[dir], "directory %s reported more than once", dir)
+		complete[dir] = true
+		// All files within directory are already written.
+		for _, name := range files {
+			p := filepath.Join(outDir, "src", filepath.FromSlash(name))
+			if strings.HasPrefix(p, dir+string(filepath.Separator)) {
+				_, err := os.Stat(p)
+				require.NoError(t, err, "%s not written before %s complete", name, dir)
+			}
+		}
+	}
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithDirCompleteHook(hook)))
+
+	expect := map[string]bool{}
+	for _, dir := range []string{"src", "src/sub", "src/sub/deep", "src/other"} {
+		expect[filepath.Join(outDir, filepath.FromSlash(dir))] = true
+	}
+	require.Equal(t, expect, complete)
+}
+
+func TestMergeMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("new"), 0640))
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	// Files outside of target directory, linked from within it.
+	outside := filepath.Join(tmpDir, "outside")
+	require.NoError(t, os.Mkdir(outside, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "keep.txt"), []byte("keep"), 0640))
+
+	populate := func(dir string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "src", "old"), 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "a.txt"), []byte("old"), 0640))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "old", "b.txt"), []byte("b"), 0640))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "extra.txt"), []byte("extra"), 0640))
+		require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+	}
+
+	// Merge is default, and preserves files not in archive.
+	for _, options := range [][]targz.Option{nil, {targz.WithMergeMode(true)}} {
+		outDir := t.TempDir()
+		populate(outDir)
+		require.NoError(t, targz.Extract(tarPath, outDir, options...))
+		data, err := os.ReadFile(filepath.Join(outDir, "src", "a.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "new", string(data))
+		for _, name := range []string{"extra.txt", "link", "src/old/b.txt"} {
+			_, err = os.Lstat(filepath.Join(outDir, filepath.FromSlash(name)))
+			require.NoError(t, err)
+		}
+	}
+
+	// Clean mode removes everything within target directory first.
+	outDir := t.TempDir()
+	populate(outDir)
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithMergeMode(false)))
+	entries, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "src", entries[0].Name())
+	entries, err = os.ReadDir(filepath.Join(outDir, "src"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "a.txt", entries[0].Name())
+
+	// Linked directory outside of target is not removed.
+	data, err := os.ReadFile(filepath.Join(outside, "keep.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "keep", string(data))
+
+	// Target directory that does not exist is created.
+	outDir = filepath.Join(t.TempDir(), "new")
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithMergeMode(false)))
+	_, err = os.Stat(filepath.Join(outDir, "src", "a.txt"))
+	require.NoError(t, err)
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("good a"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("good b"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "c.txt"), []byte("good c"), 0640))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithChecksums(true)))
+
+	// Copy archive, changing content of b.txt but not its checksum.
+	gzr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var tampered bytes.Buffer
+	gzw := gzip.NewWriter(&tampered)
+	tw := tar.NewWriter(gzw)
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			require.Len(t, hdr.PAXRecords["TARGZ.sha256"], 64)
+		}
+		if hdr.Name == "src/b.txt" {
+			data = []byte("evil b")
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	archive := tampered.Bytes()
+
+	// Without verification, tampered file is extracted.
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "evil b", string(data))
+
+	outDir = t.TempDir()
+	err = targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithVerifyChecksums(true))
+	require.ErrorIs(t, err, targz.ErrChecksumMismatch)
+	require.ErrorContains(t, err, "src/b.txt")
+	_, err = os.Stat(filepath.Join(outDir, "src", "b.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Skip bad file, and continue extracting.
+	var warnings []string
+	outDir = t.TempDir()
+	err = targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithVerifyChecksums(true),
+		targz.WithSkipBadChecksums(true), targz.WithWarningHandler(func(msg string) {
+			warnings = append(warnings, msg)
+		}))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "src/b.txt")
+	_, err = os.Stat(filepath.Join(outDir, "src", "b.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	for _, name := range []string{"a.txt", "c.txt"} {
+		_, err = os.Stat(filepath.Join(outDir, "src", name))
+		require.NoError(t, err)
+	}
+}
+
+func TestExtractEmpty(t *testing.T) {
+	outDir := t.TempDir()
+	err := targz.ExtractReader(bytes.NewReader(nil), outDir)
+	require.ErrorIs(t, err, targz.ErrEmptyArchive)
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(nil), outDir, targz.WithAllowEmpty(true)))
+
+	emptyPath := filepath.Join(t.TempDir(), "empty.tar.gz")
+	require.NoError(t, os.WriteFile(emptyPath, nil, 0644))
+	require.ErrorIs(t, targz.Extract(emptyPath, outDir), targz.ErrEmptyArchive)
+	require.ErrorIs(t, targz.ExtractAuto(emptyPath, outDir), targz.ErrEmptyArchive)
+	require.NoError(t, targz.ExtractAuto(emptyPath, outDir, targz.WithAllowEmpty(true)))
+
+	// Valid archive with only end-of-archive blocks.
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	require.NoError(t, tar.NewWriter(gzw).Close())
+	require.NoError(t, gzw.Close())
+	require.NoError(t, targz.ExtractReader(&buf, outDir))
+
+	entries, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestExtractPathTraversal(t *testing.T) {
+	for _, name := range []string{"../escape.txt", "safe/../../escape.txt", "../../etc/cron.d/x"} {
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gzw)
+		require.NoError(t, targz.WriteFile(tw, "safe/a.txt", []byte("a"), 0640, time.Now()))
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0640,
+			Size:     6,
+		}))
+		_, err := tw.Write([]byte("escape"))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, gzw.Close())
+
+		tmpDir := t.TempDir()
+		outDir := filepath.Join(tmpDir, "a", "b", "out")
+		err = targz.ExtractReader(&buf, outDir)
+		require.ErrorIs(t, err, targz.ErrOutsideTarget)
+		require.ErrorContains(t, err, name)
+
+		// Nothing is written outside of target directory.
+		err = filepath.Walk(tmpDir, func(p string, fi os.FileInfo, err error) error {
+			require.NoError(t, err)
+			if !fi.IsDir() {
+				require.Equal(t, filepath.Join(outDir, "safe", "a.txt"), p)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	// Hard link to outside of target directory.
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeLink,
+		Name:     "link",
+		Linkname: "../outside.txt",
+	}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	err := targz.ExtractReader(&buf, t.TempDir())
+	require.ErrorIs(t, err, targz.ErrOutsideTarget)
+	require.ErrorContains(t, err, "outside.txt")
+}
+
+func TestLazyDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	files := []string{"a.txt", "logs/x.log", "sub/b.txt", "sub/deep/c.log", "sub/keep/d.txt"}
+	for _, name := range files {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(srcDir, "empty"), 0700))
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	filter := func(hdr *tar.Header) bool {
+		return hdr.Typeflag == tar.TypeDir || !strings.HasSuffix(hdr.Name, ".log")
+	}
+
+	// Without lazy directories, directories of filtered files are created.
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithExtractFilter(filter)))
+	require.DirExists(t, filepath.Join(outDir, "src", "logs"))
+	require.DirExists(t, filepath.Join(outDir, "src", "sub", "deep"))
+	require.NoFileExists(t, filepath.Join(outDir, "src", "logs", "x.log"))
+
+	outDir = t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithExtractFilter(filter), targz.WithLazyDirs(true)))
+	for _, name := range []string{"src/a.txt", "src/sub/b.txt", "src/sub/keep/d.txt"} {
+		require.FileExists(t, filepath.Join(outDir, filepath.FromSlash(name)))
+	}
+	for _, name := range []string{"src/logs", "src/sub/deep", "src/empty"} {
+		require.NoDirExists(t, filepath.Join(outDir, filepath.FromSlash(name)))
+	}
+
+	// Directory created lazily still has its archived permissions.
+	fi, err := os.Stat(filepath.Join(outDir, "src", "sub", "keep"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0750), fi.Mode().Perm())
+}
+
+func TestMaterializeSymlinks(t *testing.T) {
+	writeArchive := func(links map[string]string) []byte {
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gzw)
+		// Links come before the file they refer to.
+		for _, name := range []string{"top/link", "top/sub/up", "top/chain", "top/loop1", "top/loop2", "top/missing", "top/disk"} {
+			target, ok := links[name]
+			if !ok {
+				continue
+			}
+			require.NoError(t, tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeSymlink,
+				Name:     name,
+				Linkname: target,
+				Mode:     0777,
+			}))
+		}
+		require.NoError(t, targz.WriteFile(tw, "top/file.txt", []byte("content"), 0640, time.Now()))
+		require.NoError(t, tw.Close())
+		require.NoError(t, gzw.Close())
+		return buf.Bytes()
+	}
+
+	archive := writeArchive(map[string]string{
+		"top/link":   "file.txt",
+		"top/sub/up": "../file.txt",
+		"top/chain":  "link",
+		"top/disk":   "../outside.txt",
+	})
+	outDir := t.TempDir()
+	// File on disk, not in archive.
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "outside.txt"), []byte("on disk"), 0600))
+	err := targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithMaterializeSymlinks(true))
+	require.NoError(t, err)
+	for name, content := range map[string]string{
+		"top/link":   "content",
+		"top/sub/up": "content",
+		"top/chain":  "content",
+		"top/disk":   "on disk",
+	} {
+		p := filepath.Join(outDir, filepath.FromSlash(name))
+		fi, err := os.Lstat(p)
+		require.NoError(t, err)
+		require.True(t, fi.Mode().IsRegular(), "%s is not a regular file", name)
+		data, err := os.ReadFile(p)
+		require.NoError(t, err)
+		require.Equal(t, content, string(data), name)
+	}
+
+	// Links that cannot be resolved.
+	archive = writeArchive(map[string]string{
+		"top/link":    "file.txt",
+		"top/loop1":   "loop2",
+		"top/loop2":   "loop1",
+		"top/missing": "nothing",
+	})
+	err = targz.ExtractReader(bytes.NewReader(archive), t.TempDir(), targz.WithMaterializeSymlinks(true))
+	require.ErrorContains(t, err, "symbolic link loop")
+
+	var warnings []string
+	warn := func(msg string) {
+		warnings = append(warnings, msg)
+	}
+	outDir = t.TempDir()
+	err = targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithMaterializeSymlinks(true),
+		targz.WithSkipUnresolvedSymlinks(true), targz.WithWarningHandler(warn))
+	require.NoError(t, err)
+	require.Len(t, warnings, 3)
+	require.FileExists(t, filepath.Join(outDir, "top", "link"))
+	for _, name := range []string{"loop1", "loop2", "missing"} {
+		_, err = os.Lstat(filepath.Join(outDir, "top", name))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
+
+func TestRestoreTimes(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub", "deep"), 0750))
+	names := []string{"a.txt", "sub/b.txt", "sub/deep/c.txt"}
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, filepath.FromSlash(name)), []byte(name), 0640))
+	}
+	// Set times of contents before times of directories.
+	mtimes := map[string]time.Time{}
+	for i, name := range append(names, "sub/deep", "sub", ".") {
+		mt := time.Date(2020, 1, 2, 3, 4, i, 0, time.UTC)
+		require.NoError(t, os.Chtimes(filepath.Join(srcDir, filepath.FromSlash(name)), mt, mt))
+		mtimes[name] = mt
+	}
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	for name, mt := range mtimes {
+		fi, err := os.Stat(filepath.Join(outDir, "src", filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.True(t, mt.Equal(fi.ModTime()), "%s has time %s, expected %s", name, fi.ModTime(), mt)
+	}
+
+	// Times not restored.
+	before := time.Now().Add(-time.Minute)
+	outDir = t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithRestoreTimes(false)))
+	for name := range mtimes {
+		fi, err := os.Stat(filepath.Join(outDir, "src", filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.True(t, fi.ModTime().After(before), name)
+	}
+}
+
+func TestRestoreDirTimes(t *testing.T) {
+	// Archive with an empty directory, and with a file written to a directory
+	// after a subdirectory.
+	oldTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for i, dir := range []string{"top/", "top/empty/", "top/sub/"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     dir,
+			Mode:     0750,
+			ModTime:  oldTime.Add(time.Duration(i) * time.Hour),
+		}))
+	}
+	require.NoError(t, targz.WriteFile(tw, "top/sub/file.txt", []byte("file"), 0640, oldTime))
+	require.NoError(t, targz.WriteFile(tw, "top/late.txt", []byte("late"), 0640, oldTime))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir))
+	for i, dir := range []string{"top", "top/empty", "top/sub"} {
+		fi, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(dir)))
+		require.NoError(t, err)
+		want := oldTime.Add(time.Duration(i) * time.Hour)
+		require.True(t, want.Equal(fi.ModTime()), "%s has time %s, expected %s", dir, fi.ModTime(), want)
+	}
+}
+
+func TestOverwritePolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	for _, name := range []string{"a.txt", "b.txt", "sub/c.txt"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.WriteFile(p, []byte("archived"), 0640))
+	}
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	// prepare returns a target directory containing an existing b.txt.
+	prepare := func() string {
+		outDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(outDir, "src", "sub"), 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(outDir, "src", "b.txt"), []byte("existing"), 0640))
+		return outDir
+	}
+	readFile := func(outDir, name string) string {
+		data, err := os.ReadFile(filepath.Join(outDir, "src", filepath.FromSlash(name)))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// Default is to overwrite.
+	outDir := prepare()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	require.Equal(t, "archived", readFile(outDir, "b.txt"))
+
+	outDir = prepare()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithOverwrite(targz.OverwriteAlways)))
+	require.Equal(t, "archived", readFile(outDir, "b.txt"))
+
+	outDir = prepare()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithOverwrite(targz.OverwriteSkip)))
+	require.Equal(t, "existing", readFile(outDir, "b.txt"))
+	require.Equal(t, "archived", readFile(outDir, "a.txt"))
+	require.Equal(t, "archived", readFile(outDir, "sub/c.txt"))
+
+	outDir = prepare()
+	err := targz.Extract(tarPath, outDir, targz.WithOverwrite(targz.OverwriteFail))
+	require.ErrorIs(t, err, os.ErrExist)
+	require.ErrorContains(t, err, filepath.Join(outDir, "src", "b.txt"))
+	require.Equal(t, "existing", readFile(outDir, "b.txt"))
+
+	// Existing directories do not cause failure.
+	outDir = t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(outDir, "src", "sub"), 0750))
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithOverwrite(targz.OverwriteFail)))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+}
+
+func TestSkipMatchingHash(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	for _, name := range []string{"same.txt", "changed.txt", "resized.txt", "new.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte("archived "+name), 0640))
+	}
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	outDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(outDir, "src"), 0750))
+	existing := map[string]string{
+		"same.txt":    "archived same.txt",
+		"changed.txt": "ARCHIVED changed.txt",
+		"resized.txt": "other",
+	}
+	oldTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	for name, content := range existing {
+		p := filepath.Join(outDir, "src", name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0640))
+		require.NoError(t, os.Chtimes(p, oldTime, oldTime))
+	}
+
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithSkipMatchingHash(sha256.New)))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir, targz.WithVerifyContent(true)))
+	for _, name := range []string{"same.txt", "changed.txt", "resized.txt"} {
+		fi, err := os.Stat(filepath.Join(outDir, "src", name))
+		require.NoError(t, err)
+		// Only the file with matching content is not rewritten.
+		require.Equal(t, name == "same.txt", fi.ModTime().Equal(oldTime), name)
+	}
+}
+
+func TestStripComponents(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "project-1.0")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "src", "pkg"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "README"), []byte("readme"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "src", "pkg", "main.go"), []byte("main"), 0640))
+	tarPath := filepath.Join(t.TempDir(), "project.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithStripComponents(1)))
+	data, err := os.ReadFile(filepath.Join(outDir, "README"))
+	require.NoError(t, err)
+	require.Equal(t, "readme", string(data))
+	data, err = os.ReadFile(filepath.Join(outDir, "src", "pkg", "main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "main", string(data))
+	require.NoDirExists(t, filepath.Join(outDir, "project-1.0"))
+
+	// Entries with too few components are skipped.
+	outDir = t.TempDir()
+	var names []string
+	err = targz.Extract(tarPath, outDir, targz.WithStripComponents(2), targz.WithExtractFilter(func(hdr *tar.Header) bool {
+		names = append(names, hdr.Name)
+		return true
+	}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"pkg/", "pkg/main.go"}, names)
+	require.NoFileExists(t, filepath.Join(outDir, "README"))
+	require.FileExists(t, filepath.Join(outDir, "pkg", "main.go"))
+}
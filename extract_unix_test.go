@@ -0,0 +1,362 @@
+//go:build unix
+
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootedExtraction(t *testing.T) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, targz.WriteFile(tw, "src/a.txt", []byte("a"), 0640, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "src/sub/b.txt", []byte("b"), 0640, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "back/c.txt", []byte("c"), 0640, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "file.txt", []byte("file"), 0640, time.Now()))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	archive := buf.Bytes()
+
+	tmpDir := t.TempDir()
+	outside := filepath.Join(tmpDir, "outside")
+	require.NoError(t, os.Mkdir(outside, 0750))
+	outsideFile := filepath.Join(tmpDir, "outside.txt")
+	require.NoError(t, os.WriteFile(outsideFile, []byte("outside"), 0640))
+
+	outDir := filepath.Join(tmpDir, "out")
+	require.NoError(t, os.Mkdir(outDir, 0750))
+	// Link to directory outside of target.
+	require.NoError(t, os.Symlink(outside, filepath.Join(outDir, "src")))
+	// Link back to target.
+	require.NoError(t, os.Symlink(outDir, filepath.Join(outDir, "back")))
+	// Link to file outside of target.
+	require.NoError(t, os.Symlink(outsideFile, filepath.Join(outDir, "file.txt")))
+
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithRootedExtraction(true)))
+
+	// Links are replaced by real directories and files.
+	for _, name := range []string{"src", "src/sub", "back"} {
+		fi, err := os.Lstat(filepath.Join(outDir, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.True(t, fi.IsDir(), "%s is not a directory", name)
+	}
+	for name, content := range map[string]string{"src/a.txt": "a", "src/sub/b.txt": "b", "back/c.txt": "c", "file.txt": "file"} {
+		p := filepath.Join(outDir, filepath.FromSlash(name))
+		fi, err := os.Lstat(p)
+		require.NoError(t, err)
+		require.True(t, fi.Mode().IsRegular(), "%s is not a regular file", name)
+		data, err := os.ReadFile(p)
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+
+	// Nothing is written outside of target, or through link back into it.
+	entries, err := os.ReadDir(outside)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	_, err = os.Stat(filepath.Join(outDir, "c.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	data, err := os.ReadFile(outsideFile)
+	require.NoError(t, err)
+	require.Equal(t, "outside", string(data))
+}
+
+func TestRestoreLinkTime(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "a.txt")
+	require.NoError(t, os.WriteFile(target, []byte("a"), 0640))
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(target, modTime, modTime))
+	link := filepath.Join(tmpDir, "link")
+	require.NoError(t, os.Symlink("a.txt", link))
+
+	linkTime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	require.NoError(t, targz.RestoreLinkTime(link, linkTime))
+	fi, err := os.Lstat(link)
+	require.NoError(t, err)
+	require.True(t, linkTime.Equal(fi.ModTime()))
+	// Target of link is not changed.
+	fi, err = os.Stat(link)
+	require.NoError(t, err)
+	require.True(t, modTime.Equal(fi.ModTime()))
+
+	// Broken link.
+	broken := filepath.Join(tmpDir, "broken")
+	require.NoError(t, os.Symlink("missing", broken))
+	require.NoError(t, targz.RestoreLinkTime(broken, linkTime))
+	fi, err = os.Lstat(broken)
+	require.NoError(t, err)
+	require.True(t, linkTime.Equal(fi.ModTime()))
+}
+
+func TestExtractSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+	require.NoError(t, os.Symlink("../a.txt", filepath.Join(srcDir, "sub", "rel-link")))
+	require.NoError(t, os.Symlink("sub", filepath.Join(srcDir, "dir-link")))
+	tarPath := filepath.Join(tmpDir, "internal.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	outDir := t.TempDir()
+	// Existing file is replaced by link.
+	require.NoError(t, os.MkdirAll(filepath.Join(outDir, "src", "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "src", "sub", "rel-link"), []byte("old"), 0640))
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+
+	linkname, err := os.Readlink(filepath.Join(outDir, "src", "sub", "rel-link"))
+	require.NoError(t, err)
+	require.Equal(t, "../a.txt", linkname)
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "sub", "rel-link"))
+	require.NoError(t, err)
+	require.Equal(t, "a", string(data))
+	data, err = os.ReadFile(filepath.Join(outDir, "src", "dir-link", "rel-link"))
+	require.NoError(t, err)
+	require.Equal(t, "a", string(data))
+
+	// Links to outside of target directory.
+	outsideFile := filepath.Join(tmpDir, "outside.txt")
+	require.NoError(t, os.WriteFile(outsideFile, []byte("outside"), 0640))
+	escDir := filepath.Join(tmpDir, "esc")
+	require.NoError(t, os.Mkdir(escDir, 0750))
+	for _, target := range []string{outsideFile, "../../outside.txt"} {
+		link := filepath.Join(escDir, "link")
+		require.NoError(t, os.RemoveAll(link))
+		require.NoError(t, os.Symlink(target, link))
+		tarPath = filepath.Join(tmpDir, "escaping.tar.gz")
+		require.NoError(t, targz.Create(escDir, tarPath))
+
+		outDir = t.TempDir()
+		err = targz.Extract(tarPath, outDir)
+		require.ErrorIs(t, err, targz.ErrEscapingLink)
+		_, err = os.Lstat(filepath.Join(outDir, "esc", "link"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		outDir = t.TempDir()
+		require.NoError(t, targz.Extract(tarPath, outDir, targz.WithAllowEscapingSymlinks(true)))
+		require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+		linkname, err = os.Readlink(filepath.Join(outDir, "esc", "link"))
+		require.NoError(t, err)
+		require.Equal(t, target, linkname)
+	}
+}
+
+func TestRestoreSymlinkTimes(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	linkTime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, targz.WriteFile(tw, "a.txt", []byte("a"), 0640, modTime))
+	for _, name := range []string{"link", "broken"} {
+		linkname := "a.txt"
+		if name == "broken" {
+			linkname = "missing"
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     name,
+			Linkname: linkname,
+			Mode:     0777,
+			ModTime:  linkTime,
+		}))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	archive := buf.Bytes()
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir))
+	for _, name := range []string{"link", "broken"} {
+		fi, err := os.Lstat(filepath.Join(outDir, name))
+		require.NoError(t, err)
+		require.True(t, linkTime.Equal(fi.ModTime()), name)
+	}
+	// Target of link is not changed.
+	fi, err := os.Stat(filepath.Join(outDir, "link"))
+	require.NoError(t, err)
+	require.True(t, modTime.Equal(fi.ModTime()))
+
+	outDir = t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithRestoreTimes(false)))
+	fi, err = os.Lstat(filepath.Join(outDir, "link"))
+	require.NoError(t, err)
+	require.False(t, linkTime.Equal(fi.ModTime()))
+}
+
+// linkArchive returns a gzip compressed archive of the entries, in order. The
+// content of each regular file is "evil".
+func linkArchive(t *testing.T, headers ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, hdr := range headers {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len("evil"))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0750
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte("evil"))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	return buf.Bytes()
+}
+
+func TestExtractThroughLinkedDirs(t *testing.T) {
+	// Each link appears to stay within the target directory, but x/a/y is
+	// created at y and refers to the parent of the target directory.
+	archive := linkArchive(t,
+		&tar.Header{Typeflag: tar.TypeDir, Name: "x/"},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "x/a", Linkname: ".."},
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "x/a/y", Linkname: ".."},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "x/a/y/evil"},
+	)
+	for _, options := range [][]targz.Option{
+		nil,
+		{targz.WithAllowEscapingSymlinks(true)},
+	} {
+		tmpDir := t.TempDir()
+		outDir := filepath.Join(tmpDir, "out")
+		err := targz.ExtractReader(bytes.NewReader(archive), outDir, options...)
+		require.Error(t, err)
+		if len(options) != 0 {
+			require.ErrorIs(t, err, targz.ErrOutsideTarget)
+		}
+		_, err = os.Lstat(filepath.Join(tmpDir, "evil"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+
+	// Link to outside of target, already in target directory.
+	tmpDir := t.TempDir()
+	outside := filepath.Join(tmpDir, "outside")
+	require.NoError(t, os.Mkdir(outside, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "file"), []byte("keep"), 0640))
+	outDir := filepath.Join(tmpDir, "out")
+	require.NoError(t, os.Mkdir(outDir, 0750))
+	require.NoError(t, os.Symlink(outside, filepath.Join(outDir, "linked")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "file"), filepath.Join(outDir, "file")))
+	for _, name := range []string{"linked/file", "linked/new/file", "file"} {
+		archive = linkArchive(t, &tar.Header{Typeflag: tar.TypeReg, Name: name})
+		err := targz.ExtractReader(bytes.NewReader(archive), outDir)
+		require.ErrorIs(t, err, targz.ErrOutsideTarget, name)
+	}
+	data, err := os.ReadFile(filepath.Join(outside, "file"))
+	require.NoError(t, err)
+	require.Equal(t, "keep", string(data))
+	_, err = os.Stat(filepath.Join(outside, "new"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Links within target directory are followed.
+	require.NoError(t, os.Mkdir(filepath.Join(outDir, "inside"), 0750))
+	require.NoError(t, os.Symlink("inside", filepath.Join(outDir, "in-link")))
+	archive = linkArchive(t, &tar.Header{Typeflag: tar.TypeReg, Name: "in-link/file"})
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir))
+	data, err = os.ReadFile(filepath.Join(outDir, "inside", "file"))
+	require.NoError(t, err)
+	require.Equal(t, "evil", string(data))
+}
+
+func TestExtractLinkChains(t *testing.T) {
+	// Each link appears to stay within the target directory by its name, but
+	// the links on disk lead outside of it.
+	for _, archive := range [][]byte{
+		linkArchive(t,
+			&tar.Header{Typeflag: tar.TypeDir, Name: "x/"},
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "x/a", Linkname: ".."},
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "x/a/y", Linkname: ".."},
+		),
+		linkArchive(t,
+			&tar.Header{Typeflag: tar.TypeDir, Name: "x/"},
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "x/a", Linkname: ".."},
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "x/c", Linkname: "a/../.."},
+		),
+	} {
+		outDir := t.TempDir()
+		err := targz.ExtractReader(bytes.NewReader(archive), outDir)
+		require.ErrorIs(t, err, targz.ErrEscapingLink)
+		for _, name := range []string{"y", "x/c"} {
+			_, err = os.Lstat(filepath.Join(outDir, filepath.FromSlash(name)))
+			require.ErrorIs(t, err, os.ErrNotExist)
+		}
+	}
+
+	// Hard link to file outside of target, through a symbolic link.
+	tmpDir := t.TempDir()
+	secret := filepath.Join(tmpDir, "secret")
+	require.NoError(t, os.WriteFile(secret, []byte("keep"), 0640))
+	archive := linkArchive(t,
+		&tar.Header{Typeflag: tar.TypeSymlink, Name: "up", Linkname: ".."},
+		&tar.Header{Typeflag: tar.TypeLink, Name: "stolen", Linkname: "up/secret"},
+		&tar.Header{Typeflag: tar.TypeReg, Name: "stolen"},
+	)
+	outDir := filepath.Join(tmpDir, "out")
+	for _, options := range [][]targz.Option{
+		{targz.WithAllowEscapingSymlinks(true)},
+		{targz.WithAllowEscapingSymlinks(true), targz.WithCopyLinks(true)},
+	} {
+		require.NoError(t, os.RemoveAll(outDir))
+		err := targz.ExtractReader(bytes.NewReader(archive), outDir, options...)
+		require.ErrorIs(t, err, targz.ErrOutsideTarget)
+		require.ErrorContains(t, err, "up/secret")
+		_, err = os.Lstat(filepath.Join(outDir, "stolen"))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+	data, err := os.ReadFile(secret)
+	require.NoError(t, err)
+	require.Equal(t, "keep", string(data))
+}
+
+func TestModeMapper(t *testing.T) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "open/", Mode: 0777}))
+	require.NoError(t, targz.WriteFile(tw, "open/all.txt", []byte("all"), 0666, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "open/exec.sh", []byte("exec"), 0777, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "open/private.txt", []byte("private"), 0600, time.Now()))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	// Clear umask so that it does not affect extracted modes.
+	oldMask := syscall.Umask(0)
+	defer syscall.Umask(oldMask)
+
+	var names []string
+	stripWorldWrite := func(hdr *tar.Header, mode os.FileMode) os.FileMode {
+		names = append(names, hdr.Name)
+		return mode &^ 0002
+	}
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir, targz.WithModeMapper(stripWorldWrite)))
+	require.Equal(t, []string{"open/", "open/all.txt", "open/exec.sh", "open/private.txt"}, names)
+
+	for name, perm := range map[string]os.FileMode{
+		"open":             0775,
+		"open/all.txt":     0664,
+		"open/exec.sh":     0775,
+		"open/private.txt": 0600,
+	} {
+		fi, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.Equal(t, perm, fi.Mode().Perm(), name)
+	}
+}
@@ -0,0 +1,56 @@
+package targz
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractFile copies the content of the regular file named entryName in the
+// archive file to w, without extracting anything else. The archive is read
+// only as far as the entry. Names are compared after converting path
+// separators to slashes, and removing any leading "./". If there is no such
+// entry, then the error returned wraps fs.ErrNotExist.
+func ExtractFile(tarPath, entryName string, w io.Writer, options ...Option) error {
+	opts := getOpts(options)
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rc, err := decompressReader(f, &opts)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	want := entryPath(entryName)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("%s not found in archive: %w", entryName, fs.ErrNotExist)
+			}
+			return err
+		}
+		if entryPath(hdr.Name) != want {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("%s is not a regular file", entryName)
+		}
+		_, err = copyContext(opts.ctx, w, tr)
+		return err
+	}
+}
+
+// entryPath returns the name of an archive entry with slash separators and no
+// leading "./".
+func entryPath(name string) string {
+	return strings.TrimPrefix(filepath.ToSlash(name), "./")
+}
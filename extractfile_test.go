@@ -0,0 +1,45 @@
+package targz_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractFile(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	for name, data := range map[string]string{
+		"a.txt":       "first",
+		"sub/b.txt":   "second",
+		"sub/c/d.txt": "third",
+	} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(data), 0640))
+	}
+	tarPath := filepath.Join(t.TempDir(), "src.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.ExtractFile(tarPath, "src/sub/b.txt", &buf))
+	require.Equal(t, "second", buf.String())
+
+	// Name with leading "./" and system path separators.
+	buf.Reset()
+	require.NoError(t, targz.ExtractFile(tarPath, "./"+filepath.Join("src", "sub", "c", "d.txt"), &buf))
+	require.Equal(t, "third", buf.String())
+
+	buf.Reset()
+	err := targz.ExtractFile(tarPath, "src/missing.txt", &buf)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	err = targz.ExtractFile(tarPath, "sub/b.txt", &buf)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	err = targz.ExtractFile(tarPath, "src/sub/", &buf)
+	require.ErrorContains(t, err, "not a regular file")
+	require.Zero(t, buf.Len())
+}
@@ -0,0 +1,124 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CreateFiles creates a gzip compressed tar file containing only the files and
+// directories, specified by relPaths, within baseDir. Each path in relPaths is
+// relative to baseDir, and is stored in the archive by that relative path,
+// along with entries for any parent directories within baseDir. A directory in
+// relPaths is archived with all of its contents. A symbolic link in relPaths
+// is archived as a link, unless WithFollowSymlinks is enabled.
+//
+// Entries are written in lexical order of relPaths, unless the
+// WithPreserveListOrder option is enabled. A path that does not exist is an
+// error, unless the WithSkipMissing option is enabled.
+func CreateFiles(baseDir string, relPaths []string, tarPath string, options ...Option) error {
+	tarfile, err := os.Create(tarPath)
+	if err != nil {
+		return err
+	}
+	if err = CreateFilesWriter(baseDir, relPaths, tarfile, options...); err != nil {
+		tarfile.Close()
+		return err
+	}
+	return tarfile.Close()
+}
+
+// CreateFilesWriter writes a gzip compressed tar file, containing only the
+// files and directories specified by relPaths within baseDir, to an
+// io.Writer. See CreateFiles.
+func CreateFilesWriter(baseDir string, relPaths []string, w io.Writer, options ...Option) error {
+	opts := getOpts(options)
+
+	// Validate and clean paths before writing anything.
+	cleaned := make([]string, len(relPaths))
+	for i, rel := range relPaths {
+		rel = filepath.Clean(rel)
+		if filepath.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("path %q is not within base directory", relPaths[i])
+		}
+		cleaned[i] = rel
+	}
+	if !opts.preserveListOrder {
+		sort.Strings(cleaned)
+	}
+
+	return writeArchive(w, &opts, nil, func(tw *tar.Writer) error {
+		base := opts.resolvePath(baseDir)
+		a := newArchiver(tw, &opts, ".")
+		written := map[string]struct{}{}
+		addEntry := func(e archiveEntry) error {
+			if _, found := written[e.name]; found {
+				return nil
+			}
+			written[e.name] = struct{}{}
+			return a.addEntry(e)
+		}
+
+		for _, rel := range cleaned {
+			fi, err := os.Lstat(filepath.Join(base, rel))
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) && opts.skipMissing {
+					continue
+				}
+				return err
+			}
+			if fi.Mode()&os.ModeSymlink != 0 && opts.followSymlinks {
+				// Use what the link refers to. A link that cannot be followed
+				// is stored as a link.
+				if target, err := os.Stat(filepath.Join(base, rel)); err == nil {
+					fi = target
+				}
+			}
+
+			// Write entries for parent directories.
+			slashRel := filepath.ToSlash(rel)
+			parts := strings.Split(slashRel, "/")
+			for i := 1; i < len(parts); i++ {
+				parent := strings.Join(parts[:i], "/")
+				parentPath := filepath.Join(base, filepath.FromSlash(parent))
+				pfi, err := os.Stat(parentPath)
+				if err != nil {
+					return err
+				}
+				err = addEntry(archiveEntry{
+					path: parentPath,
+					name: parent + "/",
+					info: pfi,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			if fi.IsDir() {
+				if err = walkDir(base, rel, &opts, addEntry); err != nil {
+					return err
+				}
+				continue
+			}
+			// Skip files that are not regular files or links.
+			if !fi.Mode().IsRegular() && fi.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			err = addEntry(archiveEntry{
+				path: filepath.Join(base, rel),
+				name: slashRel,
+				info: fi,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	})
+}
@@ -0,0 +1,93 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateFiles(t *testing.T) {
+	baseDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "docs/readme.md", "docs/guide/intro.md", "src/pkg/main.go", "src/pkg/util.go", "src/other.go"} {
+		p := filepath.Join(baseDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+
+	tarPath := filepath.Join(t.TempDir(), "files.tar.gz")
+	relPaths := []string{"src/pkg/main.go", "b.txt", "docs", "docs/readme.md"}
+	require.NoError(t, targz.CreateFiles(baseDir, relPaths, tarPath))
+
+	expect := []string{
+		"b.txt",
+		"docs/",
+		"docs/guide/",
+		"docs/guide/intro.md",
+		"docs/readme.md",
+		"src/",
+		"src/pkg/",
+		"src/pkg/main.go",
+	}
+	require.Equal(t, expect, archiveNames(t, tarPath))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "pkg", "main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "src/pkg/main.go", string(data))
+	_, err = os.Stat(filepath.Join(outDir, "src", "pkg", "util.go"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Missing paths.
+	relPaths = append(relPaths, "missing.txt")
+	err = targz.CreateFiles(baseDir, relPaths, tarPath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, targz.CreateFiles(baseDir, relPaths, tarPath, targz.WithSkipMissing(true)))
+	require.Equal(t, expect, archiveNames(t, tarPath))
+
+	// Paths outside base directory.
+	err = targz.CreateFiles(baseDir, []string{"../x"}, tarPath)
+	require.ErrorContains(t, err, "not within base directory")
+}
+
+func TestCreateFilesPreserveOrder(t *testing.T) {
+	baseDir := t.TempDir()
+	for _, name := range []string{"z.txt", "m.txt", "a/a.txt", "a/b.txt", "x/y/z.txt"} {
+		p := filepath.Join(baseDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+
+	relPaths := []string{"z.txt", "a/b.txt", "m.txt", "x/y/z.txt", "a/a.txt"}
+	tarPath := filepath.Join(t.TempDir(), "files.tar.gz")
+
+	require.NoError(t, targz.CreateFiles(baseDir, relPaths, tarPath))
+	expect := []string{"a/", "a/a.txt", "a/b.txt", "m.txt", "x/", "x/y/", "x/y/z.txt", "z.txt"}
+	require.Equal(t, expect, archiveNames(t, tarPath))
+
+	require.NoError(t, targz.CreateFiles(baseDir, relPaths, tarPath, targz.WithPreserveListOrder(true)))
+	expect = []string{"z.txt", "a/", "a/b.txt", "m.txt", "x/", "x/y/", "x/y/z.txt", "a/a.txt"}
+	require.Equal(t, expect, archiveNames(t, tarPath))
+}
+
+// archiveNames returns the names of all entries in the archive.
+func archiveNames(t *testing.T, tarPath string) []string {
+	f, err := os.Open(tarPath)
+	require.NoError(t, err)
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var names []string
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	return names
+}
@@ -0,0 +1,175 @@
+package targz
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Filter reads a gzip compressed tar archive from src, and writes a new gzip
+// compressed tar archive to dst that contains only the entries for which keep
+// returns true. Entries are copied as they are read, without extracting them.
+//
+// If an entry is kept, but an entry for a directory that contains it is not,
+// then the directory entry is also written so that the kept entry has its
+// parent directories. If a hard link is kept, but the file it links to is not,
+// then the link is written as a regular file with the content of that file.
+// The content of files that are not kept is stored in a temporary file until
+// filtering is done, for this purpose. Global headers are copied without
+// calling keep.
+func Filter(src io.Reader, dst io.Writer, keep func(hdr *tar.Header) bool, options ...Option) error {
+	opts := getOpts(options)
+
+	rc, err := decompressReader(src, &opts)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return writeArchive(dst, &opts, nil, func(tw *tar.Writer) error {
+		// Directory entries that were not kept, by cleaned name.
+		skippedDirs := map[string]*tar.Header{}
+		dropped := &droppedFiles{
+			files: map[string]droppedFile{},
+			links: map[string]string{},
+		}
+		defer dropped.close()
+		tr := tar.NewReader(rc)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			if hdr.Typeflag != tar.TypeXGlobalHeader && !keep(hdr) {
+				switch {
+				case isDirEntry(hdr):
+					skippedDirs[path.Clean(hdr.Name)] = hdr
+				case hdr.Typeflag == tar.TypeLink:
+					dropped.addLink(hdr)
+				case hdr.FileInfo().Mode().IsRegular():
+					if err = dropped.addFile(hdr, tr); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			// Write any skipped entries for directories containing the entry,
+			// outermost first.
+			parts := strings.Split(path.Clean(hdr.Name), "/")
+			for i := 1; i < len(parts); i++ {
+				dir := strings.Join(parts[:i], "/")
+				if dirHdr, ok := skippedDirs[dir]; ok {
+					if err = tw.WriteHeader(dirHdr); err != nil {
+						return err
+					}
+					delete(skippedDirs, dir)
+				}
+			}
+
+			var data io.Reader = tr
+			if hdr.Typeflag == tar.TypeLink {
+				if hdr, data = dropped.linkEntry(hdr); data == nil {
+					data = tr
+				}
+			}
+			if err = tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err = io.Copy(tw, data); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// droppedFiles holds the regular files and hard links that Filter did not
+// keep, so that kept hard links to them can still be written.
+type droppedFiles struct {
+	// Content of dropped files.
+	spill *os.File
+	size  int64
+	// Dropped files, by cleaned name, whose content is not yet written.
+	files map[string]droppedFile
+	// Name of the entry that a link to a dropped entry, by cleaned name,
+	// refers to instead.
+	links map[string]string
+}
+
+// droppedFile is a regular file that was not kept.
+type droppedFile struct {
+	hdr    *tar.Header
+	offset int64
+}
+
+// addFile stores the dropped regular file, reading its content from r.
+func (d *droppedFiles) addFile(hdr *tar.Header, r io.Reader) error {
+	if d.spill == nil {
+		var err error
+		if d.spill, err = os.CreateTemp("", "targz-filter-"); err != nil {
+			return err
+		}
+	}
+	n, err := io.Copy(d.spill, r)
+	if err != nil {
+		return err
+	}
+	d.files[path.Clean(hdr.Name)] = droppedFile{
+		hdr:    hdr,
+		offset: d.size,
+	}
+	d.size += n
+	return nil
+}
+
+// addLink records the dropped hard link, so that links to it refer to what it
+// links to.
+func (d *droppedFiles) addLink(hdr *tar.Header) {
+	if target := d.linkTarget(hdr.Linkname); path.Clean(target) != path.Clean(hdr.Name) {
+		d.links[path.Clean(hdr.Name)] = target
+	}
+}
+
+// linkTarget returns the name of the entry that a hard link to name refers
+// to, following dropped links.
+func (d *droppedFiles) linkTarget(name string) string {
+	if target, ok := d.links[path.Clean(name)]; ok {
+		return target
+	}
+	return name
+}
+
+// linkEntry returns the header to write for the kept hard link. If the link
+// refers to a dropped file, then a header for a regular file with the content
+// of the dropped file is returned, along with a reader of that content. Later
+// links to the dropped file then refer to this entry.
+func (d *droppedFiles) linkEntry(hdr *tar.Header) (*tar.Header, io.Reader) {
+	target := d.linkTarget(hdr.Linkname)
+	file, ok := d.files[path.Clean(target)]
+	if !ok {
+		if target != hdr.Linkname {
+			link := *hdr
+			link.Linkname = target
+			return &link, nil
+		}
+		return hdr, nil
+	}
+	delete(d.files, path.Clean(target))
+	d.links[path.Clean(target)] = hdr.Name
+	reg := *file.hdr
+	reg.Name = hdr.Name
+	return &reg, io.NewSectionReader(d.spill, file.offset, file.hdr.Size)
+}
+
+// close removes the file holding the content of dropped files.
+func (d *droppedFiles) close() {
+	if d.spill != nil {
+		d.spill.Close()
+		os.Remove(d.spill.Name())
+	}
+}
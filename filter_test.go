@@ -0,0 +1,136 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	files := []string{"a.txt", "keep/b.txt", "drop/c.txt", "drop/deep/d.txt", "only/e.txt", "only/f.log"}
+	for _, name := range files {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	// Drop the "drop" subtree, and all directory entries for "only" so that it
+	// must be written for the file that is kept within it.
+	keep := func(hdr *tar.Header) bool {
+		name := strings.TrimSuffix(hdr.Name, "/")
+		return name != "src/drop" && !strings.HasPrefix(name, "src/drop/") &&
+			name != "src/only" && name != "src/only/f.log"
+	}
+
+	src, err := os.Open(tarPath)
+	require.NoError(t, err)
+	defer src.Close()
+	var dst bytes.Buffer
+	require.NoError(t, targz.Filter(src, &dst, keep))
+
+	filteredPath := filepath.Join(tmpDir, "filtered.tar.gz")
+	require.NoError(t, os.WriteFile(filteredPath, dst.Bytes(), 0640))
+	require.ElementsMatch(t, []string{"src/", "src/a.txt", "src/keep/", "src/keep/b.txt", "src/only/", "src/only/e.txt"},
+		archiveNames(t, filteredPath))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(filteredPath, outDir))
+	require.NoError(t, targz.VerifyExtraction(filteredPath, outDir, targz.WithVerifyContent(true)))
+	_, err = os.Stat(filepath.Join(outDir, "src", "drop"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "only", "e.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "only/e.txt", string(data))
+	fi, err := os.Stat(filepath.Join(outDir, "src", "only"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0750), fi.Mode().Perm())
+}
+
+func TestFilterHardLinks(t *testing.T) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, targz.WriteFile(tw, "a.txt", []byte("content"), 0640, time.Now()))
+	// Last link is a link to a link.
+	links := [][2]string{{"link1", "a.txt"}, {"link2", "a.txt"}, {"link3", "link2"}}
+	for _, link := range links {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeLink,
+			Name:     link[0],
+			Linkname: link[1],
+			Mode:     0640,
+		}))
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	archive := buf.Bytes()
+
+	// filter returns the headers of the archive filtered to keep the named
+	// entries, and the content of its regular files.
+	filter := func(names ...string) ([]*tar.Header, map[string]string) {
+		keep := func(hdr *tar.Header) bool {
+			for _, name := range names {
+				if hdr.Name == name {
+					return true
+				}
+			}
+			return false
+		}
+		var dst bytes.Buffer
+		require.NoError(t, targz.Filter(bytes.NewReader(archive), &dst, keep))
+		gzr, err := gzip.NewReader(&dst)
+		require.NoError(t, err)
+		tr := tar.NewReader(gzr)
+		var headers []*tar.Header
+		content := map[string]string{}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			headers = append(headers, hdr)
+			if hdr.Typeflag == tar.TypeReg {
+				data, err := io.ReadAll(tr)
+				require.NoError(t, err)
+				content[hdr.Name] = string(data)
+			}
+		}
+		return headers, content
+	}
+
+	// Target kept, so links are unchanged.
+	headers, content := filter("a.txt", "link2")
+	require.Len(t, headers, 2)
+	require.Equal(t, "content", content["a.txt"])
+	require.Equal(t, byte(tar.TypeLink), headers[1].Typeflag)
+	require.Equal(t, "a.txt", headers[1].Linkname)
+
+	// First kept link becomes the file, and later links refer to it.
+	headers, content = filter("link1", "link3")
+	require.Len(t, headers, 2)
+	require.Equal(t, byte(tar.TypeReg), headers[0].Typeflag)
+	require.Equal(t, "content", content["link1"])
+	require.Equal(t, int64(0640), headers[0].Mode)
+	require.Equal(t, byte(tar.TypeLink), headers[1].Typeflag)
+	require.Equal(t, "link1", headers[1].Linkname)
+
+	// Link to a dropped link to a dropped file.
+	headers, content = filter("link3")
+	require.Len(t, headers, 1)
+	require.Equal(t, byte(tar.TypeReg), headers[0].Typeflag)
+	require.Equal(t, "content", content["link3"])
+}
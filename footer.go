@@ -0,0 +1,150 @@
+package targz
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// ErrNoFooter is returned when an archive does not end with an integrity
+// footer.
+var ErrNoFooter = errors.New("archive has no integrity footer")
+
+// ErrFooterMismatch is returned when the archive data does not match its
+// integrity footer.
+var ErrFooterMismatch = errors.New("archive does not match integrity footer")
+
+// footerMagic identifies an integrity footer.
+var footerMagic = []byte("TARGZFTR")
+
+// footerSize is the size of the content of an integrity footer: the magic,
+// the length of the compressed archive data, and the SHA-256 hash of that data.
+const footerSize = 8 + 8 + sha256.Size
+
+// footerFrame is the data surrounding the content of an integrity footer, so
+// that the footer is a valid part of the compressed data that decompresses to
+// nothing.
+type footerFrame struct {
+	prefix []byte
+	suffix []byte
+}
+
+// footerFrames holds the frame of an integrity footer for each codec.
+var footerFrames = map[Codec]footerFrame{
+	// Empty gzip member with the footer in an extra field, having subfield ID
+	// "TZ".
+	CodecGzip: {
+		prefix: []byte{
+			0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff,
+			4 + footerSize, 0, 'T', 'Z', footerSize, 0,
+		},
+		// Empty final deflate block, CRC-32 and size of empty data.
+		suffix: []byte{3, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	},
+	// Skippable zstd frame.
+	CodecZstd: {
+		prefix: []byte{0x5e, 0x2a, 0x4d, 0x18, footerSize, 0, 0, 0},
+	},
+}
+
+// size returns the size of a footer in the frame.
+func (f footerFrame) size() int {
+	return len(f.prefix) + footerSize + len(f.suffix)
+}
+
+// footerWriter counts and hashes the data written through it, so that an
+// integrity footer can be written after the data.
+type footerWriter struct {
+	w     io.Writer
+	h     hash.Hash
+	n     int64
+	frame footerFrame
+}
+
+func newFooterWriter(w io.Writer, codec Codec) *footerWriter {
+	return &footerWriter{
+		w:     w,
+		h:     sha256.New(),
+		frame: footerFrames[codec],
+	}
+}
+
+func (fw *footerWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.h.Write(p[:n])
+	fw.n += int64(n)
+	return n, err
+}
+
+// writeFooter writes the integrity footer, for the data already written, to
+// the underlying writer.
+func (fw *footerWriter) writeFooter() error {
+	footer := make([]byte, 0, fw.frame.size())
+	footer = append(footer, fw.frame.prefix...)
+	footer = append(footer, footerMagic...)
+	footer = binary.BigEndian.AppendUint64(footer, uint64(fw.n))
+	footer = fw.h.Sum(footer)
+	footer = append(footer, fw.frame.suffix...)
+	_, err := fw.w.Write(footer)
+	return err
+}
+
+// VerifyFooter checks that the archive at tarPath matches the integrity footer
+// written at its end by WithIntegrityFooter. This checks the compressed
+// archive data without reading the archive entries.
+//
+// An error wrapping ErrNoFooter is returned if the archive does not have a
+// footer, and an error wrapping ErrFooterMismatch is returned if the archive
+// data does not match the footer.
+func VerifyFooter(tarPath string) error {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var footer []byte
+	var dataSize int64
+	for _, frame := range footerFrames {
+		size := int64(frame.size())
+		if fi.Size() < size {
+			continue
+		}
+		buf := make([]byte, size)
+		if _, err = f.ReadAt(buf, fi.Size()-size); err != nil {
+			return err
+		}
+		content := buf[len(frame.prefix) : len(frame.prefix)+footerSize]
+		if bytes.HasPrefix(buf, frame.prefix) && bytes.HasSuffix(buf, frame.suffix) &&
+			bytes.HasPrefix(content, footerMagic) {
+			footer = content
+			dataSize = fi.Size() - size
+			break
+		}
+	}
+	if footer == nil {
+		return ErrNoFooter
+	}
+	length := binary.BigEndian.Uint64(footer[len(footerMagic):])
+	if length != uint64(dataSize) {
+		return fmt.Errorf("%w: archive data is %d bytes, expected %d", ErrFooterMismatch, dataSize, length)
+	}
+
+	h := sha256.New()
+	if _, err = io.Copy(h, io.LimitReader(f, int64(length))); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), footer[len(footerMagic)+8:]) {
+		return fmt.Errorf("%w: hash differs", ErrFooterMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package targz_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrityFooter(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("world"), 0640))
+
+	// Archive without footer.
+	tarPath := filepath.Join(tmpDir, "plain.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+	require.ErrorIs(t, targz.VerifyFooter(tarPath), targz.ErrNoFooter)
+
+	tarPath = filepath.Join(tmpDir, "footer.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithIntegrityFooter(true)))
+	require.NoError(t, targz.VerifyFooter(tarPath))
+
+	// Footer does not prevent extraction.
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+
+	// Footer is a gzip member that decompresses to nothing.
+	f, err := os.Open(tarPath)
+	require.NoError(t, err)
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	n, err := io.Copy(io.Discard, gzr)
+	require.NoError(t, err)
+	require.Zero(t, n%512)
+
+	// Corrupt archive data.
+	data, err := os.ReadFile(tarPath)
+	require.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	badPath := filepath.Join(tmpDir, "bad.tar.gz")
+	require.NoError(t, os.WriteFile(badPath, data, 0640))
+	require.ErrorIs(t, targz.VerifyFooter(badPath), targz.ErrFooterMismatch)
+
+	// Truncated archive data.
+	data[len(data)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(badPath, append(data[:10:10], data[11:]...), 0640))
+	require.ErrorIs(t, targz.VerifyFooter(badPath), targz.ErrFooterMismatch)
+}
+
+func TestIntegrityFooterZstd(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0640))
+
+	tarPath := filepath.Join(tmpDir, "footer.tar.zst")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithCodec(targz.CodecZstd), targz.WithIntegrityFooter(true)))
+	require.NoError(t, targz.VerifyFooter(tarPath))
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractAuto(tarPath, outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+}
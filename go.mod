@@ -2,7 +2,11 @@ module github.com/gammazero/targz
 
 go 1.20
 
-require github.com/stretchr/testify v1.8.4
+require (
+	github.com/klauspost/compress v1.17.9
+	github.com/stretchr/testify v1.8.4
+	golang.org/x/sys v0.30.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package targz
+
+import "os"
+
+// fileID identifies a file by its device and inode.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinkID reports that no file has hard links, since the file identity is
+// not available on this platform.
+func hardLinkID(fi os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
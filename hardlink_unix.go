@@ -0,0 +1,24 @@
+//go:build unix
+
+package targz
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file by its device and inode.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinkID returns the identity of the file if it has more than one hard
+// link. Returns false if the file has only one link.
+func hardLinkID(fi os.FileInfo) (fileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: st.Ino}, true
+}
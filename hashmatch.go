@@ -0,0 +1,44 @@
+package targz
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// matchExisting compares the content of the existing file at target with the
+// entry data read from r, using the configured hash. If the file exists, and
+// could have the same content, then the entry data is read into memory to
+// compare it. True is returned if the content is the same. Otherwise, a reader
+// of the entry data is returned.
+func (x *extractor) matchExisting(target string, size int64, r io.Reader) (io.Reader, bool, error) {
+	fi, err := os.Stat(target)
+	if err != nil || !fi.Mode().IsRegular() {
+		return r, false, nil
+	}
+	// Transformed data may have a different size than the entry.
+	if x.opts.extractTransform == nil && fi.Size() != size {
+		return r, false, nil
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		return r, false, nil
+	}
+	existing := x.opts.matchHash()
+	_, err = io.Copy(existing, f)
+	f.Close()
+	if err != nil {
+		return nil, false, err
+	}
+
+	entry := x.opts.matchHash()
+	data, err := io.ReadAll(io.TeeReader(r, entry))
+	if err != nil {
+		return nil, false, err
+	}
+	if bytes.Equal(existing.Sum(nil), entry.Sum(nil)) {
+		return nil, true, nil
+	}
+	return bytes.NewReader(data), false, nil
+}
@@ -0,0 +1,64 @@
+package targz
+
+import "io"
+
+// holeBlockSize is the size of the blocks that are checked for zeros when
+// detecting holes. This matches the block size of common filesystems.
+const holeBlockSize = 4096
+
+// holeFile is a file that can be written sparsely.
+type holeFile interface {
+	io.WriteCloser
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// holeWriter writes to a file, seeking over blocks of zeros instead of
+// writing them. On filesystems that support sparse files, the skipped regions
+// become holes that do not use storage.
+type holeWriter struct {
+	f   holeFile
+	off int64
+}
+
+func (w *holeWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) != 0 {
+		// Handle data up to the next block boundary.
+		n := holeBlockSize - int(w.off%holeBlockSize)
+		if n > len(p) {
+			n = len(p)
+		}
+		chunk := p[:n]
+		if isZero(chunk) {
+			if _, err := w.f.Seek(int64(n), io.SeekCurrent); err != nil {
+				return written, err
+			}
+		} else if _, err := w.f.Write(chunk); err != nil {
+			return written, err
+		}
+		w.off += int64(n)
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close sets the file size, in case the file ends with a hole, and closes the
+// file.
+func (w *holeWriter) Close() error {
+	if err := w.f.Truncate(w.off); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package targz_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectHoles(t *testing.T) {
+	const size = 4 * 1024 * 1024
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+
+	// File with data at start and middle, and zeros elsewhere, including at
+	// the end.
+	data := make([]byte, size)
+	copy(data, bytes.Repeat([]byte("start"), 1000))
+	copy(data[size/2:], bytes.Repeat([]byte("middle"), 1000))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sparse.img"), data, 0640))
+
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithDetectHoles(true)))
+
+	outPath := filepath.Join(outDir, "src", "sparse.img")
+	got, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	fi, err := os.Stat(outPath)
+	require.NoError(t, err)
+	require.Equal(t, int64(size), fi.Size())
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	allocated := int64(st.Blocks) * 512
+	if allocated >= size {
+		t.Skip("filesystem does not support sparse files")
+	}
+	require.Less(t, allocated, int64(size/4))
+}
@@ -0,0 +1,103 @@
+package targz
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// fileMatcher matches files, when creating an archive, by name or by pattern.
+type fileMatcher struct {
+	names map[string]struct{}
+	// Patterns that match base names.
+	namePatterns []string
+	// Patterns that match relative paths, split into path elements.
+	pathPatterns [][]string
+}
+
+// newIgnoreMatcher returns a fileMatcher for the names and patterns to ignore,
+// or nil if there is nothing to ignore.
+func newIgnoreMatcher(opts *config) (*fileMatcher, error) {
+	return newFileMatcher("ignore", opts.ignores, opts.ignorePatterns)
+}
+
+// newIncludeMatcher returns a fileMatcher for the patterns of files to
+// include, or nil if all files are included.
+func newIncludeMatcher(opts *config) (*fileMatcher, error) {
+	return newFileMatcher("include", nil, opts.includePatterns)
+}
+
+// newFileMatcher returns a fileMatcher for the names and patterns, or nil if
+// there are none. The kind of matcher is used in error messages.
+func newFileMatcher(kind string, names, patterns []string) (*fileMatcher, error) {
+	if len(names) == 0 && len(patterns) == 0 {
+		return nil, nil
+	}
+	m := &fileMatcher{
+		names: make(map[string]struct{}, len(names)),
+	}
+	for _, name := range names {
+		m.names[name] = struct{}{}
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", kind, pattern, err)
+		}
+		pattern = strings.Trim(pattern, "/")
+		if !strings.Contains(pattern, "/") && pattern != "**" {
+			m.namePatterns = append(m.namePatterns, pattern)
+			continue
+		}
+		m.pathPatterns = append(m.pathPatterns, strings.Split(pattern, "/"))
+	}
+	return m, nil
+}
+
+// match returns true if the file, with the given slash-separated path relative
+// to the directory being archived, is matched.
+func (m *fileMatcher) match(rel string) bool {
+	name := path.Base(rel)
+	if _, found := m.names[name]; found {
+		return true
+	}
+	for _, pattern := range m.namePatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	if len(m.pathPatterns) == 0 {
+		return false
+	}
+	elems := strings.Split(rel, "/")
+	for _, pattern := range m.pathPatterns {
+		if matchElems(pattern, elems) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchElems returns true if the path elements match the pattern elements. A
+// "**" pattern element matches zero or more path elements.
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern, elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		elems = elems[1:]
+	}
+	return len(elems) == 0
+}
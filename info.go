@@ -0,0 +1,124 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveInfo describes an archive as a whole, from the global header at the
+// start of the archive.
+type ArchiveInfo struct {
+	// Created is the time the archive was created, if it was created using
+	// WithStampCreationTime. Otherwise it is the zero time.
+	Created time.Time
+	// SchemaVersion is the version of the conventions used by the archive,
+	// if it was created using WithSchemaVersion.
+	SchemaVersion string
+}
+
+// ReadArchiveInfo reads information about the archive from the global header
+// at the start of the archive. Only the start of the archive is read.
+func ReadArchiveInfo(tarPath string, options ...Option) (ArchiveInfo, error) {
+	var info ArchiveInfo
+	opts := getOpts(options)
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+	rc, err := decompressReader(f, &opts)
+	if err != nil {
+		return info, err
+	}
+	defer rc.Close()
+
+	hdr, err := tar.NewReader(rc).Next()
+	if err != nil {
+		if err == io.EOF {
+			return info, nil
+		}
+		return info, err
+	}
+	if hdr.Typeflag != tar.TypeXGlobalHeader {
+		return info, nil
+	}
+	info.SchemaVersion = hdr.PAXRecords[paxSchema]
+	if created, ok := hdr.PAXRecords[paxCreated]; ok {
+		info.Created, err = parsePAXTime(created)
+		if err != nil {
+			return info, fmt.Errorf("invalid archive creation time %q: %w", created, err)
+		}
+	}
+	return info, nil
+}
+
+// ErrEmptyArchive is returned when archive data is empty, having zero bytes,
+// and by RootName when an archive contains no entries.
+var ErrEmptyArchive = errors.New("archive is empty")
+
+// RootName returns the top-level name of the first entry in the archive. For
+// an archive of a directory, this is the name of the directory. Only the first
+// header is read, not the rest of the archive.
+func RootName(tarPath string) (string, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	opts := getOpts(nil)
+	rc, err := decompressReader(f, &opts)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return "", ErrEmptyArchive
+			}
+			return "", err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		root, _, _ := strings.Cut(path.Clean(hdr.Name), "/")
+		return root, nil
+	}
+}
+
+// formatPAXTime formats a time as decimal seconds since the Unix epoch, which
+// is how PAX records store times.
+func formatPAXTime(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+// parsePAXTime parses a time formatted as decimal seconds since the Unix
+// epoch.
+func parsePAXTime(s string) (time.Time, error) {
+	secStr, nsecStr, _ := strings.Cut(s, ".")
+	sec, err := strconv.ParseInt(secStr, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nsec int64
+	if nsecStr != "" {
+		if len(nsecStr) > 9 {
+			nsecStr = nsecStr[:9]
+		}
+		nsecStr += strings.Repeat("0", 9-len(nsecStr))
+		if nsec, err = strconv.ParseInt(nsecStr, 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
@@ -0,0 +1,102 @@
+package targz_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStampCreationTime(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+
+	// Without option, archive has no creation time.
+	tarPath := filepath.Join(tmpDir, "plain.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+	info, err := targz.ReadArchiveInfo(tarPath)
+	require.NoError(t, err)
+	require.True(t, info.Created.IsZero())
+
+	tarPath = filepath.Join(tmpDir, "stamped.tar.gz")
+	before := time.Now()
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithStampCreationTime(true)))
+	after := time.Now()
+
+	info, err = targz.ReadArchiveInfo(tarPath)
+	require.NoError(t, err)
+	require.False(t, info.Created.Before(before), "created %s before %s", info.Created, before)
+	require.False(t, info.Created.After(after), "created %s after %s", info.Created, after)
+
+	// Global header is not extracted as an entry.
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+}
+
+func TestStampCreationTimeVolumes(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+
+	volumes, err := targz.CreateVolumes(srcDir, filepath.Join(tmpDir, "vol"), 1<<20, targz.WithStampCreationTime(true))
+	require.NoError(t, err)
+	require.Len(t, volumes, 1)
+	info, err := targz.ReadArchiveInfo(volumes[0])
+	require.NoError(t, err)
+	require.False(t, info.Created.IsZero())
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractVolumes(volumes, outDir))
+}
+
+func TestRootName(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "project")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), []byte("a"), 0640))
+
+	for _, options := range [][]targz.Option{nil, {targz.WithOmitDirEntries(true), targz.WithStampCreationTime(true)}} {
+		tarPath := filepath.Join(tmpDir, "test.tar.gz")
+		require.NoError(t, targz.Create(srcDir, tarPath, options...))
+		root, err := targz.RootName(tarPath)
+		require.NoError(t, err)
+		require.Equal(t, "project", root)
+	}
+
+	// Empty archive has no root.
+	tarPath := filepath.Join(tmpDir, "empty.tar.gz")
+	require.NoError(t, targz.CreateFiles(srcDir, nil, tarPath))
+	_, err := targz.RootName(tarPath)
+	require.ErrorIs(t, err, targz.ErrEmptyArchive)
+}
+
+func TestSchemaVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+
+	tarPath := filepath.Join(tmpDir, "plain.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+	info, err := targz.ReadArchiveInfo(tarPath)
+	require.NoError(t, err)
+	require.Empty(t, info.SchemaVersion)
+
+	tarPath = filepath.Join(tmpDir, "schema.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithSchemaVersion("2.1"), targz.WithStampCreationTime(true)))
+	info, err = targz.ReadArchiveInfo(tarPath)
+	require.NoError(t, err)
+	require.Equal(t, "2.1", info.SchemaVersion)
+	require.False(t, info.Created.IsZero())
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+}
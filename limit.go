@@ -0,0 +1,86 @@
+package targz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// ErrMaxSize is returned when the data extracted from an archive exceeds the
+// size set by WithMaxSize or WithMaxFileSize.
+var ErrMaxSize = errors.New("extracted size exceeds limit")
+
+// sizeLimitReader reads the data of a single file, and returns ErrMaxSize
+// instead of reading more than the file or total size limit allows. The data
+// actually read is counted, since an entry's header may understate its size.
+type sizeLimitReader struct {
+	r    io.Reader
+	name string
+	// Maximum bytes for this file, or 0 if not limited.
+	maxFile int64
+	// Maximum bytes for all files, or 0 if not limited.
+	maxTotal int64
+	// Bytes extracted from all files.
+	total *atomic.Int64
+	n     int64
+}
+
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	limit := int64(-1)
+	if r.maxFile > 0 {
+		limit = r.maxFile - r.n
+	}
+	if r.maxTotal > 0 {
+		left := r.maxTotal - r.total.Load()
+		if left < 0 {
+			return 0, r.limitError()
+		}
+		if limit < 0 || left < limit {
+			limit = left
+		}
+	}
+	// Read one byte more than the limit to detect exceeding it.
+	if limit >= 0 && int64(len(p)) > limit+1 {
+		p = p[:limit+1]
+	}
+	n, err := r.r.Read(p)
+	exceeded := limit >= 0 && int64(n) > limit
+	if exceeded {
+		n = int(limit)
+	}
+	if r.maxTotal > 0 && n != 0 {
+		// Files extracted concurrently may have used some of the total since
+		// the limit was computed.
+		if reserved := r.reserve(int64(n)); reserved < int64(n) {
+			n = int(reserved)
+			exceeded = true
+		}
+	}
+	r.n += int64(n)
+	if exceeded {
+		return n, r.limitError()
+	}
+	return n, err
+}
+
+// reserve adds up to n bytes to the total bytes extracted from all files,
+// without exceeding the total limit, and returns the number of bytes added.
+func (r *sizeLimitReader) reserve(n int64) int64 {
+	for {
+		total := r.total.Load()
+		if left := r.maxTotal - total; n > left {
+			n = left
+		}
+		if r.total.CompareAndSwap(total, total+n) {
+			return n
+		}
+	}
+}
+
+func (r *sizeLimitReader) limitError() error {
+	if r.maxFile > 0 && r.n >= r.maxFile {
+		return fmt.Errorf("%w: %s is larger than %d bytes", ErrMaxSize, r.name, r.maxFile)
+	}
+	return fmt.Errorf("%w: %s exceeds total of %d bytes", ErrMaxSize, r.name, r.maxTotal)
+}
@@ -0,0 +1,74 @@
+package targz_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxSize(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	data := bytes.Repeat([]byte{0}, 1000)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), data, 0640))
+	}
+	tarPath := filepath.Join(t.TempDir(), "src.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	// extractedSize returns the total size of files extracted into dir.
+	extractedSize := func(dir string) int64 {
+		var total int64
+		err := filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				total += fi.Size()
+			}
+			return err
+		})
+		require.NoError(t, err)
+		return total
+	}
+
+	outDir := t.TempDir()
+	err := targz.Extract(tarPath, outDir, targz.WithMaxSize(2500))
+	require.ErrorIs(t, err, targz.ErrMaxSize)
+	require.ErrorContains(t, err, "src/c")
+	require.Equal(t, int64(2000), extractedSize(outDir))
+	require.NoFileExists(t, filepath.Join(outDir, "src", "c"))
+
+	outDir = t.TempDir()
+	err = targz.Extract(tarPath, outDir, targz.WithMaxFileSize(999))
+	require.ErrorIs(t, err, targz.ErrMaxSize)
+	require.ErrorContains(t, err, "larger than 999 bytes")
+	require.Zero(t, extractedSize(outDir))
+
+	// Limits that are not exceeded.
+	outDir = t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithMaxSize(3000), targz.WithMaxFileSize(1000)))
+	require.Equal(t, int64(3000), extractedSize(outDir))
+}
+
+func TestMaxSizeReaderAt(t *testing.T) {
+	archive, _ := largeTar(t, 8, 128, 64)
+
+	// Files are extracted concurrently, and must not together exceed the
+	// total limit.
+	for i := 0; i < 10; i++ {
+		outDir := t.TempDir()
+		err := targz.ExtractReaderAt(bytes.NewReader(archive), int64(len(archive)), outDir, targz.WithMaxSize(30000))
+		require.ErrorIs(t, err, targz.ErrMaxSize)
+		var total int64
+		err = filepath.Walk(outDir, func(_ string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				total += fi.Size()
+			}
+			return err
+		})
+		require.NoError(t, err)
+		require.LessOrEqual(t, total, int64(30000))
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package targz
+
+import "time"
+
+// restoreLinkTime does nothing, since setting the times of a symbolic link
+// without following it is not supported.
+func restoreLinkTime(path string, modTime time.Time) error {
+	return nil
+}
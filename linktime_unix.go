@@ -0,0 +1,22 @@
+//go:build unix
+
+package targz
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// restoreLinkTime sets the access and modification times of the symbolic link
+// at path, without following the link.
+func restoreLinkTime(path string, modTime time.Time) error {
+	if modTime.IsZero() {
+		return nil
+	}
+	ts, err := unix.TimeToTimespec(modTime)
+	if err != nil {
+		return err
+	}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, []unix.Timespec{ts, ts}, unix.AT_SYMLINK_NOFOLLOW)
+}
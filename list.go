@@ -0,0 +1,113 @@
+package targz
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Entry describes an entry in an archive.
+type Entry struct {
+	// Name is the name of the entry in the archive.
+	Name string
+	// Size is the size of the file data, which is 0 for directories and links.
+	Size int64
+	// Mode holds the permissions and type of the entry.
+	Mode os.FileMode
+	// ModTime is the modification time of the entry.
+	ModTime time.Time
+	// IsDir is true if the entry is a directory.
+	IsDir bool
+	// IsSymlink is true if the entry is a symbolic link.
+	IsSymlink bool
+	// Linkname is the target of a symbolic or hard link.
+	Linkname string
+	// ContentType is the MIME type of the file content, if the archive was
+	// created using WithDetectContentType.
+	ContentType string
+}
+
+// List returns a description of each entry in the archive at tarPath, in
+// archive order, without extracting anything. Only the headers of the entries
+// are read; file data is skipped.
+func List(tarPath string, options ...Option) ([]Entry, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ListReader(f, options...)
+}
+
+// ListReader returns a description of each entry in the archive read from r.
+// See List.
+func ListReader(r io.Reader, options ...Option) ([]Entry, error) {
+	opts := getOpts(options)
+	rc, err := decompressReader(r, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var entries []Entry
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		entries = append(entries, entryFromHeader(hdr))
+	}
+	return entries, nil
+}
+
+// entryFromHeader returns the description of the entry with the header.
+func entryFromHeader(hdr *tar.Header) Entry {
+	isDir := isDirEntry(hdr)
+	mode := hdr.FileInfo().Mode()
+	if isDir {
+		mode |= os.ModeDir
+	}
+	return Entry{
+		Name:        hdr.Name,
+		Size:        hdr.Size,
+		Mode:        mode,
+		ModTime:     hdr.ModTime,
+		IsDir:       isDir,
+		IsSymlink:   hdr.Typeflag == tar.TypeSymlink,
+		Linkname:    hdr.Linkname,
+		ContentType: hdr.PAXRecords[paxContentType],
+	}
+}
+
+// ExtractedSize returns the disk space needed to extract the archive at
+// tarPath, on a filesystem with the given block size. The size of each file is
+// rounded up to a whole number of blocks, and each directory is counted as one
+// block. Links are not counted. Only the headers of the entries are read.
+func ExtractedSize(tarPath string, blockSize int64, options ...Option) (int64, error) {
+	if blockSize <= 0 {
+		return 0, fmt.Errorf("invalid block size %d", blockSize)
+	}
+	entries, err := List(tarPath, options...)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		switch {
+		case e.IsDir:
+			total += blockSize
+		case e.Mode.IsRegular():
+			total += (e.Size + blockSize - 1) / blockSize * blockSize
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,87 @@
+package targz_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	files := map[string][]byte{
+		"a.txt":     []byte("hello"),
+		"sub/b.bin": make([]byte, 100000),
+		"sub/empty": nil,
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, filepath.FromSlash(name)), data, 0640))
+	}
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithStampCreationTime(true),
+		targz.WithDetectContentType(true)))
+
+	entries, err := targz.List(tarPath)
+	require.NoError(t, err)
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+		if e.IsDir {
+			require.True(t, e.Mode.IsDir(), e.Name)
+			require.Zero(t, e.Size, e.Name)
+			continue
+		}
+		require.True(t, e.Mode.IsRegular(), e.Name)
+		require.False(t, e.IsSymlink)
+		rel, err := filepath.Rel("src", filepath.FromSlash(e.Name))
+		require.NoError(t, err)
+		require.Equal(t, int64(len(files[filepath.ToSlash(rel)])), e.Size, e.Name)
+		require.False(t, e.ModTime.IsZero())
+	}
+	require.Equal(t, []string{"src/", "src/a.txt", "src/sub/", "src/sub/b.bin", "src/sub/empty"}, names)
+	require.Equal(t, "text/plain; charset=utf-8", entries[1].ContentType)
+
+	data, err := os.ReadFile(tarPath)
+	require.NoError(t, err)
+	readerEntries, err := targz.ListReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, entries, readerEntries)
+
+	// Not an archive.
+	_, err = targz.ListReader(bytes.NewReader([]byte("not an archive")))
+	require.Error(t, err)
+}
+
+func TestExtractedSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	for name, size := range map[string]int{
+		"a.bin":     1,
+		"b.bin":     4096,
+		"sub/c.bin": 10000,
+		"sub/empty": 0,
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, filepath.FromSlash(name)), make([]byte, size), 0640))
+	}
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithStampCreationTime(true)))
+
+	// Two directories and 1+1+3+0 blocks of file data.
+	size, err := targz.ExtractedSize(tarPath, 4096)
+	require.NoError(t, err)
+	require.Equal(t, int64(7*4096), size)
+
+	// Two directories, and 1+8+20+0 blocks of file data.
+	size, err = targz.ExtractedSize(tarPath, 512)
+	require.NoError(t, err)
+	require.Equal(t, int64(31*512), size)
+
+	_, err = targz.ExtractedSize(tarPath, 0)
+	require.Error(t, err)
+}
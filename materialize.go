@@ -0,0 +1,85 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// pendingLink is a symbolic link entry to replace by a copy of its target.
+type pendingLink struct {
+	header *tar.Header
+	target string
+}
+
+// materializeLinks replaces each pending symbolic link by a copy of the file
+// it refers to. This is done after all other entries are extracted, so that a
+// link can refer to a file that comes after it in the archive.
+func (x *extractor) materializeLinks() error {
+	byTarget := make(map[string]*tar.Header, len(x.pendingLinks))
+	for _, link := range x.pendingLinks {
+		byTarget[link.target] = link.header
+	}
+	for _, link := range x.pendingLinks {
+		src, err := x.resolveLink(link.header, byTarget, map[string]struct{}{})
+		if err == nil {
+			err = x.copyLinkTarget(src, link.target)
+		}
+		if err == nil && !x.opts.skipRestoreTimes {
+			err = restoreTime(link.target, link.header.ModTime)
+		}
+		if err != nil {
+			err = fmt.Errorf("cannot materialize symbolic link %s: %w", link.header.Name, err)
+			if x.opts.skipUnresolvedLinks {
+				x.opts.warn(err.Error())
+				continue
+			}
+			return err
+		}
+		if x.opts.stats != nil {
+			x.opts.stats.add(link.header)
+		}
+		x.count++
+	}
+	x.pendingLinks = nil
+	return nil
+}
+
+// resolveLink returns the path of the file that a symbolic link refers to,
+// following any other pending links. A link that refers to a file in the
+// archive resolves to the extracted file. Otherwise, it resolves to the file
+// on disk.
+func (x *extractor) resolveLink(header *tar.Header, byTarget map[string]*tar.Header, visited map[string]struct{}) (string, error) {
+	var src string
+	if filepath.IsAbs(header.Linkname) || path.IsAbs(filepath.ToSlash(header.Linkname)) {
+		src = filepath.Clean(header.Linkname)
+	} else {
+		dir := path.Dir(path.Clean(header.Name))
+		src = filepath.Join(x.targetDir, filepath.FromSlash(dir), filepath.FromSlash(header.Linkname))
+	}
+
+	next, ok := byTarget[src]
+	if !ok {
+		return src, nil
+	}
+	if _, found := visited[src]; found {
+		return "", errors.New("symbolic link loop")
+	}
+	visited[src] = struct{}{}
+	return x.resolveLink(next, byTarget, visited)
+}
+
+// copyLinkTarget writes a copy of the file at src to target.
+func (x *extractor) copyLinkTarget(src, target string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+	return extractLink(src, target, fi.Mode().Perm(), true, x.openFile)
+}
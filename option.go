@@ -1,7 +1,137 @@
 package targz
 
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultPipeBufSize = 32 * 1024
+	defaultDirMode     = 0755
+)
+
+// fileOpenerFunc opens a file, for writing extracted data, with the given
+// permissions.
+type fileOpenerFunc func(path string, mode os.FileMode) (io.WriteCloser, error)
+
 type config struct {
-	ignores []string
+	ignores         []string
+	ignorePatterns  []string
+	includePatterns []string
+	nameTransform   func(string) (string, bool)
+	pipeBufSize     int
+	fileOpener      fileOpenerFunc
+
+	dirSizeReport func(map[string]int64)
+	warnHandler   func(string)
+	dedup         bool
+	copyLinks     bool
+	verifyContent bool
+	baseDir       string
+	capabilities  bool
+	skipMissing   bool
+
+	omitDirEntries bool
+	headerMutator  func(*tar.Header, string)
+
+	compressionDict []byte
+	throttle        func()
+	rateLimit       int64
+	detectHoles     bool
+	allowCurrentDir bool
+	defaultDirMode  os.FileMode
+	deltaBase       *Manifest
+
+	extractTransform func(string, io.Reader) io.Reader
+	rejectDuplicates bool
+
+	preserveListOrder bool
+	gzipModTime       time.Time
+	skipContentType   func(string, []byte) bool
+	stampCreationTime bool
+	dirCompleteHook   func(string)
+	maxFileRatio      float64
+	cleanTarget       bool
+	integrityFooter   bool
+	rootedExtraction  bool
+
+	parallelGzip       bool
+	compressionWorkers int
+
+	owner bool
+	uid   int
+	gid   int
+	uname string
+	gname string
+
+	checksums        bool
+	verifyChecksums  bool
+	skipBadChecksums bool
+
+	compressionLevel int
+	levelSet         bool
+
+	quarantineDir    string
+	quarantineReport func([]QuarantinedEntry)
+
+	detectContentType  bool
+	allowEmpty         bool
+	syncInterval       int64
+	followSymlinks     bool
+	allowEscapingLinks bool
+	modeMapper         func(*tar.Header, os.FileMode) os.FileMode
+	modeMask           os.FileMode
+	modeMaskSet        bool
+
+	ignoreModTime bool
+	ignoreOwner   bool
+	ignoreMode    bool
+
+	extractFilter func(*tar.Header) bool
+	stripCount    int
+	lazyDirs      bool
+	postFixPerms  bool
+	strictChown   bool
+	progressFunc  func(string, int64, int64)
+	rootMode      os.FileMode
+
+	materializeSymlinks bool
+	skipUnresolvedLinks bool
+	schemaVersion       string
+	skipRestoreTimes    bool
+	entryTimeout        time.Duration
+	skipTimedOutEntries bool
+	deterministic       bool
+	skipEmptyDirs       bool
+	overwrite           OverwritePolicy
+	matchHash           func() hash.Hash
+	dirTemplate         *dirTemplate
+	codec               Codec
+	stats               *Stats
+	dryRun              func(*tar.Header)
+	maxSize             int64
+	maxFileSize         int64
+	baseName            string
+
+	// Set by context variants of functions.
+	ctx context.Context
+	// Set by CreateWithProgress.
+	progress *progressCounter
+	// Set when extracting with a maximum file expansion ratio.
+	compressed *compressedCounter
+}
+
+// dirTemplate is the metadata given to all directory entries.
+type dirTemplate struct {
+	mode os.FileMode
+	uid  int
+	gid  int
 }
 
 // Option is a function that sets a value in a config.
@@ -16,6 +146,44 @@ func getOpts(opts []Option) config {
 	return cfg
 }
 
+// level returns the gzip compression level to use.
+func (c *config) level() int {
+	if c.levelSet {
+		return c.compressionLevel
+	}
+	return gzip.DefaultCompression
+}
+
+// warn calls the warning handler, if one is configured, with the message.
+func (c *config) warn(msg string) {
+	if c.warnHandler != nil {
+		c.warnHandler(msg)
+	}
+}
+
+// extractMode returns the mode to extract the entry with, after applying any
+// mode mapper and mode mask.
+func (c *config) extractMode(hdr *tar.Header) os.FileMode {
+	mode := hdr.FileInfo().Mode()
+	if c.modeMapper != nil {
+		mode = c.modeMapper(hdr, mode)
+	}
+	if c.modeMaskSet {
+		mode &^= os.ModePerm &^ c.modeMask
+	}
+	return mode
+}
+
+// resolvePath returns the path of p relative to the configured base
+// directory. If there is no base directory, or p is absolute, then p is
+// returned unchanged.
+func (c *config) resolvePath(p string) string {
+	if c.baseDir == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(c.baseDir, p)
+}
+
 // WithIgnore specifies file names to ignore when creating an archive. Multiple
 // names to ignore can be specified in a single call and in multiple calls to
 // WithIgnore.
@@ -24,3 +192,851 @@ func WithIgnore(names ...string) Option {
 		c.ignores = append(c.ignores, names...)
 	}
 }
+
+// WithIgnorePattern specifies patterns that match files and directories to
+// ignore when creating an archive. Patterns use the syntax of path.Match, and
+// a "**" path element matches any number of directories. A pattern with no
+// slash, such as "*.tmp" or "node_modules", is matched against the base name
+// of each file. A pattern with a slash, such as "logs/*.log" or
+// "**/cache/*", is matched against the slash-separated path relative to the
+// directory being archived. Contents of an ignored directory are also
+// ignored.
+func WithIgnorePattern(patterns ...string) Option {
+	return func(c *config) {
+		c.ignorePatterns = append(c.ignorePatterns, patterns...)
+	}
+}
+
+// WithInclude specifies patterns that match the files to include when creating
+// an archive. Only files that match at least one pattern are archived, while
+// all directories are still searched for matching files. Patterns have the
+// same syntax as for WithIgnorePattern; for example, "*.go" includes all Go
+// files, and "docs/*.md" includes the Markdown files in the docs directory. A
+// file that is ignored by WithIgnore or WithIgnorePattern is not archived even
+// if it matches an include pattern.
+func WithInclude(patterns ...string) Option {
+	return func(c *config) {
+		c.includePatterns = append(c.includePatterns, patterns...)
+	}
+}
+
+// WithNameTransform specifies a function that is called, when creating an
+// archive, with the name in the archive of each file and directory. The
+// function returns the name to archive the entry as, or false to leave the
+// entry out of the archive. Directory names end with "/", which is added to
+// the returned name if it is missing. Leaving out a directory does not leave
+// out its contents. Ignored files are not given to the function. Creating the
+// archive returns an error if a returned name is empty, absolute, or refers
+// outside of the archive root.
+func WithNameTransform(transform func(original string) (newName string, include bool)) Option {
+	return func(c *config) {
+		c.nameTransform = transform
+	}
+}
+
+// WithPipeBufferSize sets the size, in bytes, of the buffer between the
+// goroutine that creates an archive and the reader returned by CreateReader.
+// This bounds the amount of archive data held in memory when the reader
+// consumes data more slowly than it is produced. A value <= 0 uses the
+// default size of 32 KiB.
+func WithPipeBufferSize(size int) Option {
+	return func(c *config) {
+		c.pipeBufSize = size
+	}
+}
+
+// WithFileOpener specifies a function that extraction calls to open each
+// regular file for writing, instead of calling os.OpenFile. The function is
+// given the target path and permissions of the file, and returns a writer that
+// receives the file's contents. This allows extracted data to be passed
+// through a wrapper, such as a scanner or a quota-tracking writer. Directories
+// and file ownership are still handled using the os package.
+func WithFileOpener(opener func(path string, mode os.FileMode) (io.WriteCloser, error)) Option {
+	return func(c *config) {
+		c.fileOpener = opener
+	}
+}
+
+// WithDirSizeReport specifies a function that is called after an archive is
+// created, with a map of each immediate subdirectory name of the archived
+// directory to the total size, in bytes, of the files archived beneath it.
+// Files directly within the archived directory are not included.
+func WithDirSizeReport(report func(map[string]int64)) Option {
+	return func(c *config) {
+		c.dirSizeReport = report
+	}
+}
+
+// WithWarningHandler specifies a function that is called with a message when
+// a non-fatal problem is encountered. For example, when extracting an archive
+// that is named as a tar.gz but is really an uncompressed tar.
+func WithWarningHandler(handler func(msg string)) Option {
+	return func(c *config) {
+		c.warnHandler = handler
+	}
+}
+
+// WithDedup, when enabled, stores the content of files that have identical
+// content only once when creating an archive. Each file whose content is the
+// same as a file already in the archive is stored as a hard link to that file.
+// This can greatly reduce the size of archives containing many duplicate
+// files, at the cost of reading each file twice.
+func WithDedup(enable bool) Option {
+	return func(c *config) {
+		c.dedup = enable
+	}
+}
+
+// WithCopyLinks, when enabled, extracts each hard link in an archive as a
+// separate copy of the linked file, instead of as a hard link.
+func WithCopyLinks(enable bool) Option {
+	return func(c *config) {
+		c.copyLinks = enable
+	}
+}
+
+// WithVerifyContent, when enabled, causes VerifyExtraction to compare the
+// content of each extracted file with the content in the archive, in addition
+// to checking the file size.
+func WithVerifyContent(enable bool) Option {
+	return func(c *config) {
+		c.verifyContent = enable
+	}
+}
+
+// WithBaseName sets the name of the top-level directory in a created archive,
+// instead of the base name of the directory being archived. Every entry in the
+// archive is named within this directory. For example, archiving
+// "/build/output-2024" with the base name "release" writes the entry
+// "release/bin/app" for the file "/build/output-2024/bin/app". The name must
+// not contain any path separators.
+func WithBaseName(name string) Option {
+	return func(c *config) {
+		c.baseName = name
+	}
+}
+
+// WithBaseDir specifies the directory relative to which a relative source
+// directory path is interpreted when creating an archive. This makes the
+// result independent of the process's current directory. An absolute source
+// directory path is not affected.
+func WithBaseDir(base string) Option {
+	return func(c *config) {
+		c.baseDir = base
+	}
+}
+
+// WithCapabilities, when enabled, preserves Linux file capabilities, stored
+// in the "security.capability" extended attribute, of archived files. When
+// creating an archive, capabilities are stored in PAX records. When extracting
+// an archive, the stored capabilities are restored, which requires privileges
+// to set file capabilities. This option has no effect when creating an archive
+// on other platforms, and extracting a file with capabilities returns an error.
+func WithCapabilities(enable bool) Option {
+	return func(c *config) {
+		c.capabilities = enable
+	}
+}
+
+// WithSkipMissing, when enabled, causes CreateFiles to skip any listed path
+// that does not exist, instead of returning an error.
+func WithSkipMissing(enable bool) Option {
+	return func(c *config) {
+		c.skipMissing = enable
+	}
+}
+
+// WithOmitDirEntries, when enabled, creates an archive that does not contain
+// entries for directories. Only file entries, named by their full relative
+// paths, are written. When such an archive is extracted, directories are
+// created as needed to hold the extracted files, so empty directories are not
+// recreated.
+func WithOmitDirEntries(enable bool) Option {
+	return func(c *config) {
+		c.omitDirEntries = enable
+	}
+}
+
+// WithHeaderMutator specifies a function that is called to modify the header
+// of each entry immediately before it is written to the archive. The function
+// is given the header and the path of the file the header describes. This
+// allows setting any header field, such as PAX records, that is not otherwise
+// controlled by an option.
+//
+// The mutator must not change the header in a way that breaks the structure
+// of the archive: the Name must remain the entry's path within the archive,
+// and the Size and Typeflag of regular files must not change, since the file
+// data is written after the header.
+func WithHeaderMutator(mutator func(hdr *tar.Header, path string)) Option {
+	return func(c *config) {
+		c.headerMutator = mutator
+	}
+}
+
+// WithCompressionDict specifies a preset dictionary to use for compressing an
+// archive. A dictionary containing data similar to the archived files, such as
+// a typical file, can improve compression of archives of many small similar
+// files. The result is gzip formatted, but can only be decompressed using the
+// same dictionary, so the same WithCompressionDict option must be given when
+// extracting the archive.
+func WithCompressionDict(dict []byte) Option {
+	return func(c *config) {
+		c.compressionDict = dict
+	}
+}
+
+// WithThrottle specifies a function that is called before each file is added
+// to an archive. This allows the caller to pause archiving, for example by
+// sleeping in the function to limit the rate of I/O.
+func WithThrottle(throttle func()) Option {
+	return func(c *config) {
+		c.throttle = throttle
+	}
+}
+
+// WithRateLimit limits the rate, in bytes per second, at which file data is
+// read when creating an archive. This prevents archiving from saturating I/O.
+// A value <= 0 means no limit.
+func WithRateLimit(bytesPerSec int64) Option {
+	return func(c *config) {
+		c.rateLimit = bytesPerSec
+	}
+}
+
+// WithDetectHoles, when enabled, checks the content of each extracted file
+// for blocks of zeros, and skips over these instead of writing them. On
+// filesystems that support sparse files, this leaves holes in the extracted
+// files that do not use storage. This applies to files opened by a custom
+// opener only if the opened file supports Seek and Truncate.
+func WithDetectHoles(enable bool) Option {
+	return func(c *config) {
+		c.detectHoles = enable
+	}
+}
+
+// WithAllowCurrentDir, when enabled, allows Create to archive the current
+// directory. If the archive file is written into the current directory, then
+// it should be excluded from the archive using WithIgnore.
+func WithAllowCurrentDir(enable bool) Option {
+	return func(c *config) {
+		c.allowCurrentDir = enable
+	}
+}
+
+// WithDefaultDirMode sets the permissions of directories that are created
+// implicitly during extraction, because the archive does not contain entries
+// for them. Directories that have archive entries are created with the
+// permissions from the archive. The default is 0755.
+func WithDefaultDirMode(mode os.FileMode) Option {
+	return func(c *config) {
+		c.defaultDirMode = mode.Perm()
+	}
+}
+
+// WithDeltaBase creates a delta archive relative to the base archive described
+// by the manifest. Only regular files that are not in the manifest, or that
+// have a different size or modification time than in the manifest, are stored
+// in the archive. Directory entries are always stored. The modification time
+// of each stored file is also recorded, in a PAX record, as the number of
+// seconds after the manifest's reference time.
+//
+// Files that were removed since the base archive was created are not recorded
+// in the delta archive.
+func WithDeltaBase(base Manifest) Option {
+	return func(c *config) {
+		c.deltaBase = &base
+	}
+}
+
+// WithExtractContentTransform specifies a function that transforms the content
+// of each regular file during extraction. The function is given the entry name
+// and a reader of the archived content, and returns a reader of the content to
+// write to the extracted file. This allows content to be decrypted or
+// otherwise modified as it is extracted. The length of the transformed content
+// does not need to match the archived size.
+func WithExtractContentTransform(transform func(name string, r io.Reader) io.Reader) Option {
+	return func(c *config) {
+		c.extractTransform = transform
+	}
+}
+
+// WithRejectDuplicates, when enabled, causes extraction to return an error
+// wrapping ErrDuplicateEntry if the archive contains more than one entry for
+// the same path. Otherwise, a later entry overwrites an earlier one. This
+// detects archives that were tampered with or incorrectly generated.
+func WithRejectDuplicates(enable bool) Option {
+	return func(c *config) {
+		c.rejectDuplicates = enable
+	}
+}
+
+// WithPreserveListOrder, when enabled, causes CreateFiles to write entries in
+// exactly the order that paths are listed, instead of in lexical order. Entries
+// for the directories containing a listed path are written immediately before
+// the first entry within them.
+func WithPreserveListOrder(enable bool) Option {
+	return func(c *config) {
+		c.preserveListOrder = enable
+	}
+}
+
+// WithGzipModTime sets the modification time stored in the gzip header of a
+// created archive. This is separate from the modification times of archived
+// files. By default the gzip header has no modification time, which is stored
+// as zero, so that archives of the same content do not differ by when they
+// were created.
+func WithGzipModTime(modTime time.Time) Option {
+	return func(c *config) {
+		c.gzipModTime = modTime
+	}
+}
+
+// WithSkipContentType sets a function that is called, when creating an archive
+// of a directory, with the archive name of each file and up to the first 512
+// bytes of its content. If the function returns true, then the file is not
+// archived. This allows files to be excluded by type, such as by a signature
+// at the start of the file, regardless of the file name.
+func WithSkipContentType(skip func(name string, header []byte) bool) Option {
+	return func(c *config) {
+		c.skipContentType = skip
+	}
+}
+
+// WithStampCreationTime, when enabled, records the time that an archive is
+// created in a global header at the start of the archive. This is separate
+// from the modification times of archived files and from the gzip header
+// time. The creation time is read using ReadArchiveInfo.
+func WithStampCreationTime(enable bool) Option {
+	return func(c *config) {
+		c.stampCreationTime = enable
+	}
+}
+
+// WithDirCompleteHook sets a function that is called, during extraction, with
+// the path of each extracted directory once all entries within it have been
+// written. A directory is considered complete when the sequence of archive
+// entries leaves that directory. This is best-effort: if an archive is not
+// ordered so that all entries within a directory are together, then the
+// function is called for a directory before all of its entries are written,
+// and may be called more than once for the same directory.
+func WithDirCompleteHook(hook func(dir string)) Option {
+	return func(c *config) {
+		c.dirCompleteHook = hook
+	}
+}
+
+// WithMaxFileRatio sets the maximum ratio by which any single file in an
+// archive may expand when decompressed. If a file's data exceeds this ratio,
+// then extraction stops with an error wrapping ErrFileRatio, and the file
+// being written is removed. This detects decompression bombs made of
+// pathological single entries.
+//
+// Since gzip does not record the compressed size of each file, the compressed
+// size is estimated from the compressed data consumed while the file is read.
+// This is at least 4KiB for any file, so small files do not exceed the limit.
+// A value of 0, the default, does not limit the ratio.
+func WithMaxFileRatio(ratio float64) Option {
+	return func(c *config) {
+		c.maxFileRatio = ratio
+	}
+}
+
+// WithMaxSize sets the maximum total number of bytes of file data that
+// extraction writes. If the archive contains more data, then extraction stops
+// with an error wrapping ErrMaxSize, and the file being written is removed.
+// The data is counted as it is extracted, so the limit holds even if entry
+// headers understate file sizes. This protects against decompression bombs
+// filling the disk. A value of 0, the default, does not limit the size.
+func WithMaxSize(bytes int64) Option {
+	return func(c *config) {
+		c.maxSize = bytes
+	}
+}
+
+// WithMaxFileSize sets the maximum number of bytes of data that extraction
+// writes for any single file. If a file contains more data, then extraction
+// stops with an error wrapping ErrMaxSize, and the file is removed. A value of
+// 0, the default, does not limit the size.
+func WithMaxFileSize(bytes int64) Option {
+	return func(c *config) {
+		c.maxFileSize = bytes
+	}
+}
+
+// WithMergeMode sets whether extraction merges an archive into the existing
+// contents of the target directory. When enabled, the default, files and
+// directories already in the target directory that are not in the archive are
+// left as they are, so that an archive can be extracted as an overlay onto an
+// existing tree. When disabled, everything within the target directory is
+// removed before extracting. The target directory itself is not removed, and
+// nothing outside of it is removed.
+func WithMergeMode(enable bool) Option {
+	return func(c *config) {
+		c.cleanTarget = !enable
+	}
+}
+
+// WithIntegrityFooter, when enabled, appends an integrity footer to a created
+// archive, after the end of the compressed data. The footer contains the
+// length and SHA-256 hash of the compressed data, so that the archive can be
+// checked by VerifyFooter without reading its entries. The footer is stored
+// as an empty gzip member, or as a skippable frame when compressing with zstd,
+// so that decompressors, such as gzip and zstd, read it as part of the
+// archive and produce no data from it.
+func WithIntegrityFooter(enable bool) Option {
+	return func(c *config) {
+		c.integrityFooter = enable
+	}
+}
+
+// WithRootedExtraction, when enabled, keeps extraction within the real
+// directory tree of the target directory. Extraction does not go through any
+// symbolic link within the target directory. Instead, a link in place of a
+// directory is replaced by a real directory, and a link in place of a file is
+// replaced by the file. This prevents writing outside of the target directory,
+// or looping back into it, through links that already exist there. Without
+// this option, extraction through links that lead outside of the target
+// directory returns an error.
+func WithRootedExtraction(enable bool) Option {
+	return func(c *config) {
+		c.rootedExtraction = enable
+	}
+}
+
+// WithParallelGzip, when enabled, compresses archive data using multiple
+// goroutines. The data is split into blocks that are compressed concurrently,
+// and written as a multi-member gzip stream that any gzip reader decompresses.
+// The number of goroutines is GOMAXPROCS, unless limited by
+// WithGOMAXPROCSForCompression. This is not used with WithCompressionDict.
+func WithParallelGzip(enable bool) Option {
+	return func(c *config) {
+		c.parallelGzip = enable
+	}
+}
+
+// WithGOMAXPROCSForCompression limits the number of goroutines that compress
+// data in parallel when WithParallelGzip is enabled, to cap the CPU used for
+// compression. A value of 1 compresses using a single goroutine, the same as
+// when parallel compression is not enabled. A value of 0, the default, uses
+// GOMAXPROCS goroutines.
+func WithGOMAXPROCSForCompression(n int) Option {
+	return func(c *config) {
+		c.compressionWorkers = n
+	}
+}
+
+// WithOwnerNames sets the user and group names that are recorded as the owner
+// of every archived file and directory, instead of the names of the local
+// owners. The numeric user and group IDs are recorded as zero, so that
+// ownership is represented only by the names. This makes archives portable
+// between hosts where the same names have different IDs.
+func WithOwnerNames(uname, gname string) Option {
+	return WithOwner(0, 0, uname, gname)
+}
+
+// WithOwner sets the user and group IDs and names that are recorded as the
+// owner of every archived file and directory, instead of those of the local
+// owners. For example, WithOwner(0, 0, "root", "root") creates an archive of
+// files owned by root, when archived by another user, so that the files have
+// the right owner when extracted as root. Names may be empty. Creating an
+// archive with a negative ID returns an error.
+func WithOwner(uid, gid int, uname, gname string) Option {
+	return func(c *config) {
+		c.owner = true
+		c.uid = uid
+		c.gid = gid
+		c.uname = uname
+		c.gname = gname
+	}
+}
+
+// WithChecksums, when enabled, records the SHA-256 hash of each archived
+// file's content in the file's header. The hash is checked when extracting
+// using WithVerifyChecksums.
+func WithChecksums(enable bool) Option {
+	return func(c *config) {
+		c.checksums = enable
+	}
+}
+
+// WithVerifyChecksums, when enabled, checks the content of each extracted file
+// that has a checksum recorded by WithChecksums. The content is hashed as the
+// file is written. If the hash does not match, then the file is removed and
+// extraction stops with an error wrapping ErrChecksumMismatch, unless
+// WithSkipBadChecksums is enabled.
+func WithVerifyChecksums(enable bool) Option {
+	return func(c *config) {
+		c.verifyChecksums = enable
+	}
+}
+
+// WithSkipBadChecksums, when enabled along with WithVerifyChecksums, continues
+// extraction when a file does not match its checksum. The file is removed and
+// reported to the warning handler, and is not counted as extracted.
+func WithSkipBadChecksums(enable bool) Option {
+	return func(c *config) {
+		c.skipBadChecksums = enable
+	}
+}
+
+// WithCompressionLevel sets the gzip compression level used to create an
+// archive. The level is one of the levels defined by the compress/gzip
+// package, from gzip.NoCompression to gzip.BestCompression, or
+// gzip.HuffmanOnly. EstimateRatio helps to choose a level. The default is
+// gzip.DefaultCompression. Creating an archive with any other level returns
+// an error.
+func WithCompressionLevel(level int) Option {
+	return func(c *config) {
+		c.compressionLevel = level
+		c.levelSet = true
+	}
+}
+
+// WithQuarantine specifies a directory into which extraction writes entries
+// that fail safety checks, instead of writing them into the target directory.
+// An entry is unsafe if its name is empty, is absolute, contains a NUL
+// character, or refers outside of the target directory, if it is a hard link
+// to such a name, or if it is a symbolic link to outside of the target
+// directory that WithAllowEscapingSymlinks does not allow. Unsafe entries are
+// written under dir with sanitized names, except for links which are not
+// created.
+//
+// After extraction, the report function, if not nil, is called with the
+// entries that were quarantined.
+func WithQuarantine(dir string, report func([]QuarantinedEntry)) Option {
+	return func(c *config) {
+		c.quarantineDir = dir
+		c.quarantineReport = report
+	}
+}
+
+// WithDetectContentType, when enabled, records the MIME type of each archived
+// file in the file's header. The type is detected from up to the first 512
+// bytes of the file's content, using http.DetectContentType.
+func WithDetectContentType(enable bool) Option {
+	return func(c *config) {
+		c.detectContentType = enable
+	}
+}
+
+// WithAllowEmpty, when enabled, makes extracting empty archive data, having
+// zero bytes, succeed without extracting anything. Otherwise, extracting empty
+// data returns ErrEmptyArchive. An archive that is valid but has no entries is
+// always extracted without error.
+func WithAllowEmpty(enable bool) Option {
+	return func(c *config) {
+		c.allowEmpty = enable
+	}
+}
+
+// WithSyncInterval sets the number of bytes of compressed data after which
+// buffered archive data is flushed to the underlying writer during creation.
+// Flushing more often limits how much data is lost if the process stops while
+// writing to a store that keeps what it receives, such as an append-only
+// remote store. This does not flush the compressor, so it does not affect the
+// compressed data. A value <= 0, the default, flushes only when the buffer is
+// full.
+func WithSyncInterval(n int64) Option {
+	return func(c *config) {
+		c.syncInterval = n
+	}
+}
+
+// WithFollowSymlinks, when enabled, archives the file or directory that each
+// symbolic link refers to, instead of the link itself. A link that cannot be
+// followed is archived as a link. When disabled, the default, each link is
+// archived as a link to the same target.
+func WithFollowSymlinks(enable bool) Option {
+	return func(c *config) {
+		c.followSymlinks = enable
+	}
+}
+
+// WithAllowEscapingSymlinks, when enabled, extracts symbolic links whose
+// targets are absolute or refer outside of the target directory. By default,
+// extracting such a link returns an error wrapping ErrEscapingLink, since the
+// link could be used to access files outside of the target directory. Where a
+// link refers to is found by following any links already in the target
+// directory. Files are never extracted through escaping links, and hard links
+// are never made to files outside of the target directory.
+func WithAllowEscapingSymlinks(enable bool) Option {
+	return func(c *config) {
+		c.allowEscapingLinks = enable
+	}
+}
+
+// WithModeMapper specifies a function that is called, during extraction, with
+// the header and mode of each entry. The permissions of the returned mode are
+// used to create the file or directory, instead of the permissions from the
+// archive. This allows permissions to be made to follow a policy, such as by
+// removing write permission for others, or by giving all directories the same
+// permissions.
+func WithModeMapper(mapper func(hdr *tar.Header, mode os.FileMode) os.FileMode) Option {
+	return func(c *config) {
+		c.modeMapper = mapper
+	}
+}
+
+// WithModeMask sets a mask that the permissions of each extracted file and
+// directory are ANDed with. For example, a mask of 0755 removes write
+// permission for group and others, so that no extracted file is
+// world-writable. The mask is applied after any WithModeMapper function. By
+// default, permissions are not masked.
+func WithModeMask(mask os.FileMode) Option {
+	return func(c *config) {
+		c.modeMask = mask
+		c.modeMaskSet = true
+	}
+}
+
+// WithIgnoreModTime, when enabled, causes ArchivesEqual to not compare the
+// modification times of entries.
+func WithIgnoreModTime(enable bool) Option {
+	return func(c *config) {
+		c.ignoreModTime = enable
+	}
+}
+
+// WithIgnoreOwner, when enabled, causes ArchivesEqual to not compare the user
+// and group IDs and names of entries.
+func WithIgnoreOwner(enable bool) Option {
+	return func(c *config) {
+		c.ignoreOwner = enable
+	}
+}
+
+// WithIgnoreMode, when enabled, causes ArchivesEqual to not compare the
+// permissions of entries.
+func WithIgnoreMode(enable bool) Option {
+	return func(c *config) {
+		c.ignoreMode = enable
+	}
+}
+
+// WithExtractFilter specifies a function that is called, during extraction,
+// with the header of each entry. Only entries for which the function returns
+// true are extracted.
+func WithExtractFilter(filter func(hdr *tar.Header) bool) Option {
+	return func(c *config) {
+		c.extractFilter = filter
+	}
+}
+
+// WithStripComponents removes the first n slash-separated elements from the
+// name of each entry before it is extracted, like the --strip-components
+// option of tar. For example, with n of 1, the entry "project/src/main.go" is
+// extracted to "src/main.go" in the target directory. Entries that have no
+// more than n elements, such as the top-level directory, are skipped. The
+// names are stripped before any filter set by WithExtractFilter is called.
+func WithStripComponents(n int) Option {
+	return func(c *config) {
+		c.stripCount = n
+	}
+}
+
+// WithLazyDirs, when enabled, defers creating each directory extracted from
+// an archive until a file, or link, is extracted into it. Directories that
+// end up holding nothing, such as when all of their contents are excluded by
+// WithExtractFilter, are not created. An empty directory in the archive is
+// also not created.
+func WithLazyDirs(enable bool) Option {
+	return func(c *config) {
+		c.lazyDirs = enable
+	}
+}
+
+// WithPostFixPermissions, when enabled, sets the permissions, and ownership
+// if extracting as root, of every extracted entry in a final pass after all
+// entries are written. This helps permissions to take effect on filesystems,
+// such as some NAS and SMB mounts, that ignore the permissions given when a
+// file is created. Each permission or ownership change that fails is reported
+// to the warning handler given by WithWarningHandler.
+func WithPostFixPermissions(enable bool) Option {
+	return func(c *config) {
+		c.postFixPerms = enable
+	}
+}
+
+// WithStrictChown, when enabled, returns an error if the owner of an extracted
+// entry cannot be set. The owner is only set when extracting as root, and the
+// entry's user or group name is found on the host. By default, failure to set
+// the owner is ignored, since some filesystems, such as NAS mounts, do not
+// allow it.
+func WithStrictChown(enable bool) Option {
+	return func(c *config) {
+		c.strictChown = enable
+	}
+}
+
+// WithProgress specifies a function that is called as file data is archived
+// by Create, CreateWriter, or CreateReader, and as file data is extracted. The
+// function is called with the name of the current file, the number of bytes of
+// file data processed so far, and the total number of bytes of file data. The
+// function is called at least once for each file, and periodically while
+// copying the data of a large file.
+//
+// When creating an archive, the total is computed by walking the directory
+// before creating the archive. When extracting, the total is not known, and
+// is given as -1.
+func WithProgress(progress func(entry string, bytesDone, bytesTotal int64)) Option {
+	return func(c *config) {
+		c.progressFunc = progress
+	}
+}
+
+// WithRootMode sets the permissions of the entry for the top-level directory
+// of an archive, instead of using the permissions of the directory being
+// archived. The permissions of entries within the top-level directory are not
+// changed.
+func WithRootMode(mode os.FileMode) Option {
+	return func(c *config) {
+		c.rootMode = mode
+	}
+}
+
+// WithMaterializeSymlinks, when enabled, extracts each symbolic link as a
+// copy of the file that the link refers to, for systems that do not allow
+// symbolic links. If the link refers to a file in the archive, then the link
+// is a copy of that file, even if the file comes after the link in the
+// archive. Otherwise, the link is a copy of the file on disk that the link
+// refers to.
+//
+// A link that refers to a directory, to a file that does not exist, or that
+// is part of a loop of links, cannot be materialized and causes extraction to
+// return an error, unless WithSkipUnresolvedSymlinks is enabled.
+func WithMaterializeSymlinks(enable bool) Option {
+	return func(c *config) {
+		c.materializeSymlinks = enable
+	}
+}
+
+// WithSkipUnresolvedSymlinks, when enabled, skips each symbolic link that
+// cannot be materialized by WithMaterializeSymlinks, and reports it to the
+// warning handler, instead of returning an error.
+func WithSkipUnresolvedSymlinks(enable bool) Option {
+	return func(c *config) {
+		c.skipUnresolvedLinks = enable
+	}
+}
+
+// WithSchemaVersion stores the version string in a global header at the start
+// of a created archive. This identifies the conventions, such as custom PAX
+// records, used by the archive, so that readers can handle features specific
+// to a version. The version is read using ReadArchiveInfo.
+func WithSchemaVersion(version string) Option {
+	return func(c *config) {
+		c.schemaVersion = version
+	}
+}
+
+// WithRestoreTimes, when enabled, the default, sets the modification time of
+// each extracted file and directory to the time stored in the archive. The
+// times of directories are set after all entries are extracted, since
+// extracting entries into a directory changes its modification time. The
+// times of symbolic links are set, without following the links, on Unix
+// platforms; elsewhere they are not set. When disabled, extracted files have
+// the time that they are written.
+func WithRestoreTimes(enable bool) Option {
+	return func(c *config) {
+		c.skipRestoreTimes = !enable
+	}
+}
+
+// WithEntryTimeout sets the maximum time allowed to open and write each file
+// extracted from an archive. If writing a file takes longer, such as when a
+// network filesystem stops responding, then the partly written file is removed
+// and extraction returns an error wrapping ErrEntryTimeout. A write that times
+// out may continue in the background. A value <= 0, the default, allows any
+// amount of time.
+func WithEntryTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.entryTimeout = d
+	}
+}
+
+// WithSkipTimedOutEntries, when enabled along with WithEntryTimeout, continues
+// extraction when writing a file times out. The partly written file is
+// removed and reported to the warning handler, and is not counted as
+// extracted.
+func WithSkipTimedOutEntries(enable bool) Option {
+	return func(c *config) {
+		c.skipTimedOutEntries = enable
+	}
+}
+
+// WithDeterministic, when enabled, creates an archive that is byte-for-byte
+// identical to any other archive of the same content created with the same
+// options. Every entry has a fixed modification time, no owner, and
+// permissions of 0755 for directories and executable files, and 0644 for
+// other files. The gzip header has no modification time, unless one is set
+// by WithGzipModTime. WithStampCreationTime must not be used, since it stores
+// the current time.
+func WithDeterministic(enable bool) Option {
+	return func(c *config) {
+		c.deterministic = enable
+	}
+}
+
+// WithSkipEmptyDirs, when enabled, omits directories that contain nothing to
+// archive from a created archive. A directory that contains only ignored files,
+// or only directories that are omitted, is also omitted. The top-level
+// directory is always archived.
+func WithSkipEmptyDirs(enable bool) Option {
+	return func(c *config) {
+		c.skipEmptyDirs = enable
+	}
+}
+
+// WithOverwrite sets the policy for extracting a file, or link, to a path
+// where a file already exists. The default, OverwriteAlways, replaces the
+// existing file. Existing directories are always left in place.
+func WithOverwrite(policy OverwritePolicy) Option {
+	return func(c *config) {
+		c.overwrite = policy
+	}
+}
+
+// WithSkipMatchingHash, when extracting, compares the content of each file to
+// extract with the content of any existing file at the same path, using hashes
+// created by the hash function, such as sha256.New. If the content is the
+// same, then the existing file is left unchanged, including its modification
+// time. This avoids rewriting unchanged files when modification times cannot
+// be relied on.
+//
+// Comparing content has a cost: each existing file of the same size as the
+// entry is read in full, and the entry's data is held in memory while it is
+// compared, so that it can be written if the content differs.
+func WithSkipMatchingHash(newHash func() hash.Hash) Option {
+	return func(c *config) {
+		c.matchHash = newHash
+	}
+}
+
+// WithDirTemplate gives every directory entry in a created archive the same
+// permissions and owner IDs, instead of those of each directory. Owner names
+// are removed from directory entries, unless set by WithOwnerNames. The top
+// level directory has the permissions set by WithRootMode, if given. Entries
+// for files are not changed.
+func WithDirTemplate(mode os.FileMode, uid, gid int) Option {
+	return func(c *config) {
+		c.dirTemplate = &dirTemplate{
+			mode: mode,
+			uid:  uid,
+			gid:  gid,
+		}
+	}
+}
+
+// WithCodec sets the compression format used to create an archive. The
+// default is CodecGzip. With CodecZstd, any level given by
+// WithCompressionLevel is a zstd level, and options specific to gzip are not
+// used.
+//
+// Extraction detects the compression format from the archive data, so
+// archives of any format are extracted without this option. If the format of
+// the archive is not that of the codec, then a warning is issued.
+func WithCodec(codec Codec) Option {
+	return func(c *config) {
+		c.codec = codec
+	}
+}
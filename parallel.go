@@ -0,0 +1,146 @@
+package targz
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+	"time"
+)
+
+// parallelBlockSize is the size of the uncompressed blocks that are each
+// compressed separately by the parallel compressor.
+const parallelBlockSize = 1024 * 1024
+
+// compressBlock compresses a block of data as a complete gzip member.
+var compressBlock = func(block []byte, level int, modTime time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	gzw, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	gzw.ModTime = modTime
+	if _, err := gzw.Write(block); err != nil {
+		return nil, err
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressResult is the result of compressing one block.
+type compressResult struct {
+	data []byte
+	err  error
+}
+
+// parallelGzipWriter compresses data using multiple goroutines. Data is split
+// into blocks that are compressed concurrently, each as a separate gzip member.
+// The members are written in order, forming a multi-member gzip stream that
+// any gzip reader decompresses as a whole.
+type parallelGzipWriter struct {
+	w       io.Writer
+	level   int
+	modTime time.Time
+	block   []byte
+	wrote   bool
+
+	// Limits the number of blocks being compressed at once.
+	workers chan struct{}
+	// Results of blocks in the order they are written.
+	pending chan chan compressResult
+	done    chan struct{}
+
+	mutex sync.Mutex
+	err   error
+}
+
+func newParallelGzipWriter(w io.Writer, workers, level int, modTime time.Time) *parallelGzipWriter {
+	p := &parallelGzipWriter{
+		w:       w,
+		level:   level,
+		modTime: modTime,
+		block:   make([]byte, 0, parallelBlockSize),
+		workers: make(chan struct{}, workers),
+		pending: make(chan chan compressResult, workers),
+		done:    make(chan struct{}),
+	}
+	go p.writeResults(p.pending)
+	return p
+}
+
+func (p *parallelGzipWriter) Write(data []byte) (int, error) {
+	if err := p.getErr(); err != nil {
+		return 0, err
+	}
+	var written int
+	for len(data) != 0 {
+		n := copy(p.block[len(p.block):cap(p.block)], data)
+		p.block = p.block[:len(p.block)+n]
+		data = data[n:]
+		written += n
+		if len(p.block) == cap(p.block) {
+			p.compress()
+		}
+	}
+	return written, nil
+}
+
+// Close compresses any remaining data and waits for all compressed data to be
+// written.
+func (p *parallelGzipWriter) Close() error {
+	if p.pending == nil {
+		return p.getErr()
+	}
+	// Write at least one member, so that the output is valid gzip data.
+	if len(p.block) != 0 || !p.wrote {
+		p.compress()
+	}
+	close(p.pending)
+	p.pending = nil
+	<-p.done
+	return p.getErr()
+}
+
+// compress starts compressing the current block, and starts a new block.
+func (p *parallelGzipWriter) compress() {
+	block := p.block
+	p.block = make([]byte, 0, parallelBlockSize)
+	p.wrote = true
+
+	result := make(chan compressResult, 1)
+	p.pending <- result
+	p.workers <- struct{}{}
+	go func() {
+		data, err := compressBlock(block, p.level, p.modTime)
+		<-p.workers
+		result <- compressResult{data: data, err: err}
+	}()
+}
+
+// writeResults writes the compressed blocks in order.
+func (p *parallelGzipWriter) writeResults(pending <-chan chan compressResult) {
+	defer close(p.done)
+	for result := range pending {
+		res := <-result
+		if p.getErr() != nil {
+			continue
+		}
+		err := res.err
+		if err == nil {
+			_, err = p.w.Write(res.data)
+		}
+		if err != nil {
+			p.mutex.Lock()
+			p.err = err
+			p.mutex.Unlock()
+		}
+	}
+}
+
+func (p *parallelGzipWriter) getErr() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
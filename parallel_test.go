@@ -0,0 +1,74 @@
+package targz_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelGzip(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	for i := 0; i < 4; i++ {
+		data := bytes.Repeat([]byte(fmt.Sprintf("file %d line\n", i)), 200000)
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, fmt.Sprintf("f%d.txt", i)), data, 0640))
+	}
+
+	for _, workers := range []int{1, 2, 3} {
+		var mutex sync.Mutex
+		var active, maxActive, blocks int
+		restore := targz.SetCompressBlock(func(block []byte, level int, modTime time.Time) ([]byte, error) {
+			mutex.Lock()
+			active++
+			blocks++
+			if active > maxActive {
+				maxActive = active
+			}
+			mutex.Unlock()
+			// Give other workers time to start.
+			time.Sleep(20 * time.Millisecond)
+			defer func() {
+				mutex.Lock()
+				active--
+				mutex.Unlock()
+			}()
+			return targz.CompressBlock(block, level, modTime)
+		})
+
+		tarPath := filepath.Join(tmpDir, "test.tar.gz")
+		err := targz.Create(srcDir, tarPath, targz.WithParallelGzip(true), targz.WithGOMAXPROCSForCompression(workers))
+		restore()
+		require.NoError(t, err)
+
+		if workers == 1 {
+			// Single goroutine does not use parallel compressor.
+			require.Zero(t, blocks)
+		} else {
+			require.Greater(t, blocks, workers)
+			require.Equal(t, workers, maxActive)
+		}
+
+		outDir := t.TempDir()
+		require.NoError(t, targz.Extract(tarPath, outDir))
+		require.NoError(t, targz.VerifyExtraction(tarPath, outDir, targz.WithVerifyContent(true)))
+	}
+}
+
+func TestParallelGzipEmpty(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	err := targz.CreateFiles(srcDir, nil, tarPath, targz.WithParallelGzip(true), targz.WithGOMAXPROCSForCompression(4))
+	require.NoError(t, err)
+	require.NoError(t, targz.Extract(tarPath, t.TempDir()))
+}
@@ -0,0 +1,22 @@
+package targz
+
+// PAX records used by this package.
+const (
+	// paxCapability holds a file's Linux capabilities. This uses the same
+	// convention as GNU tar for storing extended attributes.
+	paxCapability = "SCHILY.xattr.security.capability"
+	// paxMtimeDelta holds a file's modification time as the number of
+	// seconds after the reference time of the base of a delta archive.
+	paxMtimeDelta = "TARGZ.mtime_delta"
+	// paxVolume holds a volume's sequence number in a global header.
+	paxVolume = "TARGZ.volume"
+	// paxCreated holds the time an archive was created in a global header.
+	paxCreated = "TARGZ.created"
+	// paxSHA256 holds the hex encoded SHA-256 hash of a file's content.
+	paxSHA256 = "TARGZ.sha256"
+	// paxContentType holds the MIME type detected from a file's content.
+	paxContentType = "TARGZ.content_type"
+	// paxSchema holds the schema version, of the conventions used by an
+	// archive, in a global header.
+	paxSchema = "TARGZ.schema"
+)
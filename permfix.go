@@ -0,0 +1,65 @@
+package targz
+
+import (
+	"fmt"
+	"os"
+)
+
+// permSetter sets the permissions and ownership of extracted files.
+type permSetter interface {
+	Chmod(name string, mode os.FileMode) error
+	Lchown(name string, uid, gid int) error
+}
+
+// osPerms sets permissions and ownership using the os package.
+type osPerms struct{}
+
+func (osPerms) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (osPerms) Lchown(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid)
+}
+
+// perms is replaced in tests to simulate filesystems that do not allow
+// setting permissions or ownership.
+var perms permSetter = osPerms{}
+
+// permFix records the permissions and ownership to apply to an extracted
+// entry in the final permission fix pass.
+type permFix struct {
+	path    string
+	perm    os.FileMode
+	uid     int
+	gid     int
+	symlink bool
+}
+
+// fixPermissions applies the recorded permissions, and ownership, to all
+// extracted entries. Entries are fixed in reverse order, so that the contents
+// of a directory are fixed before the directory itself. Each fix that fails
+// is reported as a warning, except that failure to set ownership is returned
+// as an error if WithStrictChown is enabled.
+func (x *extractor) fixPermissions() error {
+	for i := len(x.permFixes) - 1; i >= 0; i-- {
+		fix := x.permFixes[i]
+		if fix.uid != -1 || fix.gid != -1 {
+			if err := perms.Lchown(fix.path, fix.uid, fix.gid); err != nil {
+				if x.opts.strictChown {
+					return fmt.Errorf("cannot set owner of %s: %w", fix.path, err)
+				}
+				x.opts.warn(fmt.Sprintf("cannot set owner of %s: %s", fix.path, err))
+			}
+		}
+		// Permissions of a symbolic link are not used.
+		if fix.symlink {
+			continue
+		}
+		if err := perms.Chmod(fix.path, fix.perm); err != nil {
+			x.opts.warn(fmt.Sprintf("cannot set permissions of %s: %s", fix.path, err))
+		}
+	}
+	x.permFixes = nil
+	return nil
+}
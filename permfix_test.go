@@ -0,0 +1,121 @@
+package targz_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+// nasPerms simulates a filesystem where setting permissions on some files
+// fails.
+type nasPerms struct {
+	fail  string
+	modes map[string]os.FileMode
+	order []string
+}
+
+func (p *nasPerms) Chmod(name string, mode os.FileMode) error {
+	if filepath.Base(name) == p.fail {
+		return errors.New("operation not permitted")
+	}
+	p.modes[name] = mode
+	p.order = append(p.order, name)
+	return os.Chmod(name, mode)
+}
+
+func (p *nasPerms) Lchown(name string, uid, gid int) error {
+	return nil
+}
+
+func TestPostFixPermissions(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("b"), 0600))
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	p := &nasPerms{
+		fail:  "b.txt",
+		modes: map[string]os.FileMode{},
+	}
+	defer targz.SetPermSetter(p)()
+
+	// File opener that ignores the requested permissions.
+	opener := func(name string, mode os.FileMode) (io.WriteCloser, error) {
+		return os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	}
+	var warnings []string
+	warn := func(msg string) {
+		warnings = append(warnings, msg)
+	}
+
+	// Permission fix pass not enabled.
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithFileOpener(opener)))
+	require.Empty(t, p.modes)
+
+	outDir = t.TempDir()
+	err := targz.Extract(tarPath, outDir, targz.WithFileOpener(opener), targz.WithPostFixPermissions(true),
+		targz.WithWarningHandler(warn))
+	require.NoError(t, err)
+
+	srcPath := filepath.Join(outDir, "src")
+	subPath := filepath.Join(srcPath, "sub")
+	aPath := filepath.Join(srcPath, "a.txt")
+	require.Equal(t, map[string]os.FileMode{
+		srcPath: 0750,
+		subPath: 0750,
+		aPath:   0640,
+	}, p.modes)
+
+	// Contents fixed before the directories that contain them.
+	pos := map[string]int{}
+	for i, name := range p.order {
+		pos[name] = i
+	}
+	require.Less(t, pos[aPath], pos[srcPath])
+	require.Less(t, pos[subPath], pos[srcPath])
+
+	require.Len(t, warnings, 1)
+	require.True(t, strings.Contains(warnings[0], "b.txt"), warnings[0])
+}
+
+// chownFailPerms simulates a filesystem where setting ownership fails.
+type chownFailPerms struct{}
+
+func (chownFailPerms) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (chownFailPerms) Lchown(name string, uid, gid int) error {
+	return errors.New("operation not permitted")
+}
+
+func TestStrictChown(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("owner is only set when extracting as root")
+	}
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithOwnerNames("root", "root")))
+
+	defer targz.SetPermSetter(chownFailPerms{})()
+
+	// Failure is ignored by default.
+	require.NoError(t, targz.Extract(tarPath, t.TempDir()))
+
+	err := targz.Extract(tarPath, t.TempDir(), targz.WithStrictChown(true))
+	require.ErrorContains(t, err, "cannot set owner")
+	require.ErrorContains(t, err, "operation not permitted")
+}
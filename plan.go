@@ -0,0 +1,250 @@
+package targz
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Action is what extraction does with an archive entry.
+type Action int
+
+const (
+	// ActionCreate creates a new file or directory.
+	ActionCreate Action = iota
+	// ActionOverwrite replaces an existing file.
+	ActionOverwrite
+	// ActionSkip leaves the target unchanged. This is the action for
+	// directories that already exist, for files that already exist when the
+	// overwrite policy is OverwriteSkip, for entries of types that are not
+	// extracted, and for directories that are not created because nothing is
+	// extracted into them when using WithLazyDirs.
+	ActionSkip
+	// ActionQuarantine writes an unsafe entry to the quarantine directory set
+	// by WithQuarantine, instead of to the target directory.
+	ActionQuarantine
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionCreate:
+		return "create"
+	case ActionOverwrite:
+		return "overwrite"
+	case ActionSkip:
+		return "skip"
+	case ActionQuarantine:
+		return "quarantine"
+	}
+	return "unknown"
+}
+
+// OverwritePolicy is what extraction does when a file to extract already
+// exists in the target directory.
+type OverwritePolicy int
+
+const (
+	// OverwriteAlways replaces the existing file. This is the default.
+	OverwriteAlways OverwritePolicy = iota
+	// OverwriteSkip leaves the existing file unchanged, and does not extract
+	// the entry.
+	OverwriteSkip
+	// OverwriteFail stops extraction and returns an error that names the
+	// existing file and wraps os.ErrExist.
+	OverwriteFail
+)
+
+func (p OverwritePolicy) String() string {
+	switch p {
+	case OverwriteAlways:
+		return "always"
+	case OverwriteSkip:
+		return "skip"
+	case OverwriteFail:
+		return "fail"
+	}
+	return "unknown"
+}
+
+// PlanEntry describes the action that extraction takes for an archive entry.
+type PlanEntry struct {
+	// Name is the name of the entry in the archive.
+	Name string
+	// Path is the location the entry is extracted to. For a quarantined
+	// entry, this is the location in the quarantine directory, or empty if
+	// the entry has no content to write, such as a link.
+	Path string
+	// Action is what extraction does at Path.
+	Action Action
+}
+
+// ExtractDryRun reports what extracting the archive at tarPath into targetDir,
+// using the same options, would do, without writing anything. A PlanEntry is
+// returned for each entry in the archive, in archive order.
+func ExtractDryRun(tarPath, targetDir string, options ...Option) ([]PlanEntry, error) {
+	opts := getOpts(options)
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rc, err := decompressReader(f, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	x := newExtractor(targetDir, &opts)
+	x.planned = map[string]struct{}{}
+	p := &planner{x: x}
+	if opts.lazyDirs {
+		p.pendingDirs = map[string]int{}
+	}
+
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, x.readError(err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if !opts.selectEntry(header) {
+			continue
+		}
+		if err = p.add(header); err != nil {
+			return nil, err
+		}
+	}
+	// Directories with nothing extracted into them are not created.
+	for _, i := range p.pendingDirs {
+		p.plan[i].Action = ActionSkip
+	}
+	return p.plan, nil
+}
+
+// planner plans the extraction of entries, keeping track of the directories
+// that extracting the entries creates, in the same way that extraction does.
+type planner struct {
+	x    *extractor
+	plan []PlanEntry
+	// Index in plan of each directory entry not yet created, by target path,
+	// when creating directories lazily.
+	pendingDirs map[string]int
+}
+
+// add appends the plan for the entry described by header, as prepareEntry
+// and writeEntry extract it.
+func (p *planner) add(header *tar.Header) error {
+	x := p.x
+	if x.opts.quarantineDir != "" {
+		if reason := unsafeReason(header, x.opts.allowEscapingLinks); reason != "" {
+			entry := PlanEntry{
+				Name:   header.Name,
+				Action: ActionQuarantine,
+			}
+			switch {
+			case header.Typeflag == tar.TypeLink, header.Typeflag == tar.TypeSymlink:
+				// Link is not written.
+			case isDirEntry(header), header.FileInfo().Mode().IsRegular():
+				entry.Path = x.quarantinePath(header)
+			}
+			x.quarantined = append(x.quarantined, QuarantinedEntry{
+				Name:   header.Name,
+				Path:   entry.Path,
+				Reason: reason,
+			})
+			p.plan = append(p.plan, entry)
+			return nil
+		}
+	}
+
+	entry, err := x.planEntry(header)
+	if err != nil {
+		return err
+	}
+	if entry.Action != ActionSkip {
+		if p.pendingDirs != nil && isDirEntry(header) {
+			// Directory is created when something is extracted into it.
+			p.pendingDirs[entry.Path] = len(p.plan)
+		} else {
+			if p.pendingDirs != nil {
+				p.makePendingDirs(filepath.Dir(entry.Path))
+			}
+			p.makeParentDirs(filepath.Dir(entry.Path))
+			if isDirEntry(header) {
+				delete(x.implicitDirs, entry.Path)
+			}
+		}
+	}
+	p.plan = append(p.plan, entry)
+	return nil
+}
+
+// makePendingDirs plans the creation of the pending directories that contain
+// dir, as extractor.makePendingDirs creates them.
+func (p *planner) makePendingDirs(dir string) {
+	x := p.x
+	var dirs []string
+	for dir != x.targetDir && x.withinTarget(dir) {
+		dirs = append(dirs, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	// Create outermost directories first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if _, ok := p.pendingDirs[dirs[i]]; ok {
+			delete(p.pendingDirs, dirs[i])
+			p.makeParentDirs(filepath.Dir(dirs[i]))
+		}
+	}
+}
+
+// makeParentDirs plans the creation of the directory dir and any missing
+// parents, as writeEntry creates them. Directories created within the target
+// directory are recorded as implicit, as by extractor.makeParentDirs, except
+// when using rooted extraction.
+func (p *planner) makeParentDirs(dir string) {
+	x := p.x
+	root := filepath.Clean(x.targetDir)
+	for d := dir; d != root && x.withinTarget(d); d = filepath.Dir(d) {
+		if exists, err := x.exists(d); err != nil || exists {
+			break
+		}
+		x.planned[d] = struct{}{}
+		if x.opts.rootedExtraction {
+			continue
+		}
+		if x.implicitDirs == nil {
+			x.implicitDirs = map[string]struct{}{}
+		}
+		x.implicitDirs[d] = struct{}{}
+	}
+}
+
+// CreateDryRun reports the entries that creating an archive of dir, using the
+// same options, would write, without writing any archive data. This applies
+// all of the options that select files, such as WithIgnorePattern, so it shows
+// why a file is or is not archived. An Entry is returned for each entry, in
+// archive order.
+func CreateDryRun(dir string, options ...Option) ([]Entry, error) {
+	opts := getOpts(options)
+	var entries []Entry
+	opts.dryRun = func(hdr *tar.Header) {
+		entries = append(entries, entryFromHeader(hdr))
+	}
+	if err := tarAddDir(dir, &opts, tar.NewWriter(io.Discard)); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,202 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractDryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "old"), 0750))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "new"), 0750))
+	for _, name := range []string{"a.txt", "b.txt", "old/c.txt", "new/d.txt"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.WriteFile(p, []byte("archived "+name), 0640))
+	}
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	// Pre-populate target with some of the archived files.
+	outDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(outDir, "src", "old"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "src", "b.txt"), []byte("existing"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "src", "old", "c.txt"), []byte("existing"), 0640))
+
+	plan, err := targz.ExtractDryRun(tarPath, outDir)
+	require.NoError(t, err)
+
+	expect := map[string]targz.Action{
+		"src/":          targz.ActionSkip,
+		"src/a.txt":     targz.ActionCreate,
+		"src/b.txt":     targz.ActionOverwrite,
+		"src/new/":      targz.ActionCreate,
+		"src/new/d.txt": targz.ActionCreate,
+		"src/old/":      targz.ActionSkip,
+		"src/old/c.txt": targz.ActionOverwrite,
+	}
+	require.Len(t, plan, len(expect))
+	existed := map[string]bool{}
+	for _, p := range plan {
+		require.Equal(t, expect[p.Name], p.Action, p.Name)
+		require.Equal(t, filepath.Join(outDir, filepath.FromSlash(p.Name)), p.Path)
+		_, err = os.Stat(p.Path)
+		existed[p.Name] = err == nil
+	}
+
+	// Nothing was written.
+	_, err = os.Stat(filepath.Join(outDir, "src", "a.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Check that real extraction does what was planned.
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	for _, p := range plan {
+		switch p.Action {
+		case targz.ActionCreate:
+			require.False(t, existed[p.Name])
+			_, err = os.Stat(p.Path)
+			require.NoError(t, err)
+		case targz.ActionOverwrite:
+			require.True(t, existed[p.Name])
+			data, err := os.ReadFile(p.Path)
+			require.NoError(t, err)
+			require.Equal(t, "archived "+p.Name[len("src/"):], string(data))
+		case targz.ActionSkip:
+			require.True(t, existed[p.Name])
+		}
+	}
+}
+
+func TestCreateDryRun(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub", "build"), 0750))
+	for name, data := range map[string]string{
+		"keep.txt":           "keep",
+		"skip.log":           "skip",
+		"sub/keep.go":        "package sub",
+		"sub/build/out.bin":  "out",
+		"sub/nested/more.md": "more",
+	} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(data), 0640))
+	}
+	options := []targz.Option{
+		targz.WithIgnorePattern("*.log"),
+		targz.WithIgnorePattern("sub/build"),
+	}
+
+	planned, err := targz.CreateDryRun(srcDir, options...)
+	require.NoError(t, err)
+	tarPath := filepath.Join(t.TempDir(), "src.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, options...))
+	archived, err := targz.List(tarPath)
+	require.NoError(t, err)
+
+	require.Equal(t, len(archived), len(planned))
+	for i := range archived {
+		require.Equal(t, archived[i].Name, planned[i].Name)
+		require.Equal(t, archived[i].Size, planned[i].Size)
+		require.Equal(t, archived[i].IsDir, planned[i].IsDir)
+	}
+	var names []string
+	for _, e := range planned {
+		names = append(names, e.Name)
+	}
+	require.Equal(t, []string{"src/", "src/keep.txt", "src/sub/", "src/sub/keep.go", "src/sub/nested/", "src/sub/nested/more.md"}, names)
+}
+
+// planArchive writes a gzip compressed archive of the entries to a file and
+// returns its path. Names ending in a slash are directories.
+func planArchive(t *testing.T, names ...string) string {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			require.NoError(t, tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     name,
+				Mode:     0700,
+				ModTime:  time.Now(),
+			}))
+			continue
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0640,
+			Size:     int64(len(name)),
+			ModTime:  time.Now(),
+		}))
+		_, err := tw.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	tarPath := filepath.Join(t.TempDir(), "test.tar.gz")
+	require.NoError(t, os.WriteFile(tarPath, buf.Bytes(), 0640))
+	return tarPath
+}
+
+func TestExtractDryRunDirs(t *testing.T) {
+	// Directory entries after the files they contain.
+	tarPath := planArchive(t, "top/sub/a.txt", "top/sub/", "top/", "top/sub/")
+	outDir := t.TempDir()
+	plan, err := targz.ExtractDryRun(tarPath, outDir)
+	require.NoError(t, err)
+	actions := make([]targz.Action, len(plan))
+	for i := range plan {
+		actions[i] = plan[i].Action
+	}
+	require.Equal(t, []targz.Action{targz.ActionCreate, targz.ActionOverwrite, targz.ActionOverwrite, targz.ActionSkip}, actions)
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	fi, err := os.Stat(filepath.Join(outDir, "top", "sub"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+
+	// Lazy directories that nothing is extracted into are not created.
+	tarPath = planArchive(t, "top/", "top/empty/", "top/a.txt")
+	outDir = t.TempDir()
+	plan, err = targz.ExtractDryRun(tarPath, outDir, targz.WithLazyDirs(true))
+	require.NoError(t, err)
+	require.Len(t, plan, 3)
+	require.Equal(t, targz.ActionCreate, plan[0].Action)
+	require.Equal(t, targz.ActionSkip, plan[1].Action)
+	require.Equal(t, targz.ActionCreate, plan[2].Action)
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithLazyDirs(true)))
+	require.NoDirExists(t, filepath.Join(outDir, "top", "empty"))
+}
+
+func TestExtractDryRunQuarantine(t *testing.T) {
+	tarPath := planArchive(t, "ok.txt", "../evil.txt")
+	qDir := t.TempDir()
+	outDir := t.TempDir()
+
+	_, err := targz.ExtractDryRun(tarPath, outDir)
+	require.ErrorIs(t, err, targz.ErrOutsideTarget)
+
+	plan, err := targz.ExtractDryRun(tarPath, outDir, targz.WithQuarantine(qDir, nil))
+	require.NoError(t, err)
+	require.Len(t, plan, 2)
+	require.Equal(t, targz.ActionCreate, plan[0].Action)
+	require.Equal(t, targz.ActionQuarantine, plan[1].Action)
+	require.NoFileExists(t, plan[1].Path)
+
+	var report []targz.QuarantinedEntry
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithQuarantine(qDir, func(q []targz.QuarantinedEntry) {
+		report = q
+	})))
+	require.Len(t, report, 1)
+	require.Equal(t, report[0].Path, plan[1].Path)
+	require.FileExists(t, plan[1].Path)
+}
@@ -0,0 +1,111 @@
+package targz
+
+import (
+	"io"
+)
+
+// CreateWithProgress creates a gzip compressed tar file containing the
+// contents of the specified directory, as Create does, and calls the progress
+// function as file data is archived. The progress function is called with the
+// number of bytes of file data archived so far, and the total number of bytes
+// of file data to archive.
+//
+// The total is computed before creating the archive, by walking the directory
+// using the same options as used to create the archive. Files that are not
+// stored in the archive, because they are unchanged from a delta base, are
+// duplicates, or are dropped by WithNameTransform, still count toward the
+// bytes archived, so that the number of bytes archived reaches the total.
+func CreateWithProgress(dir, tarPath string, progress func(done, total int64), options ...Option) error {
+	options = append(options, WithProgress(func(_ string, done, total int64) {
+		progress(done, total)
+	}))
+	return Create(dir, tarPath, options...)
+}
+
+// newCreateProgress returns a progressCounter that reports the progress of
+// archiving the directories, if a progress function is configured.
+func newCreateProgress(dirs []string, opts *config) (*progressCounter, error) {
+	if opts.progressFunc == nil {
+		return nil, nil
+	}
+	var total int64
+	for _, dir := range dirs {
+		size, err := archiveDataSize(dir, opts)
+		if err != nil {
+			return nil, err
+		}
+		total += size
+	}
+	return &progressCounter{
+		total:  total,
+		report: opts.progressFunc,
+	}, nil
+}
+
+// archiveDataSize returns the total size of the files in dir that are
+// archived using the options.
+func archiveDataSize(dir string, opts *config) (int64, error) {
+	parent, dir, err := splitParent(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	err = walkDir(parent, dir, opts, func(e archiveEntry) error {
+		if e.info.Mode().IsRegular() {
+			total += e.info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// progressCounter counts the bytes of file data archived, or extracted, and
+// reports the count. The total is -1 if it is not known.
+type progressCounter struct {
+	total  int64
+	done   int64
+	report func(entry string, done, total int64)
+
+	// Name of current file.
+	entry string
+	// Bytes of current file counted.
+	fileDone int64
+}
+
+// startFile starts counting the bytes of the named file.
+func (p *progressCounter) startFile(name string) {
+	p.entry = name
+	p.fileDone = 0
+}
+
+// add counts n more bytes of the current file.
+func (p *progressCounter) add(n int64) {
+	p.fileDone += n
+	p.done += n
+	p.report(p.entry, p.done, p.total)
+}
+
+// finishFile counts any bytes, of the file of the given size, that were not
+// already counted, and reports the progress after the file.
+func (p *progressCounter) finishFile(size int64) {
+	if remaining := size - p.fileDone; remaining > 0 {
+		p.done += remaining
+	}
+	p.report(p.entry, p.done, p.total)
+	p.fileDone = 0
+}
+
+// progressReader counts the bytes read from a reader.
+type progressReader struct {
+	r        io.Reader
+	progress *progressCounter
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n != 0 {
+		r.progress.add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,123 @@
+package targz_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateWithProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	sizes := map[string]int{
+		"a.bin":      100 * 1024,
+		"b.bin":      3000,
+		"sub/c.bin":  50 * 1024,
+		"sub/dup":    3000,
+		"ignore.tmp": 7777,
+	}
+	for name, size := range sizes {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.WriteFile(p, make([]byte, size), 0640))
+	}
+	var expectTotal int64
+	for name, size := range sizes {
+		if name != "ignore.tmp" {
+			expectTotal += int64(size)
+		}
+	}
+
+	for _, dedup := range []bool{false, true} {
+		var calls int
+		var lastDone, lastTotal int64
+		progress := func(done, total int64) {
+			require.GreaterOrEqual(t, done, lastDone, "progress went backwards")
+			lastDone = done
+			lastTotal = total
+			calls++
+		}
+
+		tarPath := filepath.Join(tmpDir, "test.tar.gz")
+		err := targz.CreateWithProgress(srcDir, tarPath, progress,
+			targz.WithIgnore("ignore.tmp"), targz.WithDedup(dedup))
+		require.NoError(t, err)
+		require.Equal(t, expectTotal, lastTotal)
+		require.Equal(t, lastTotal, lastDone)
+		require.GreaterOrEqual(t, calls, 4)
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	sizes := map[string]int{
+		"src/big.bin":     1024 * 1024,
+		"src/small.bin":   3000,
+		"src/sub/c.bin":   50 * 1024,
+		"src/sub/empty":   0,
+		"src/sub/another": 10,
+	}
+	var expectTotal int64
+	for name, size := range sizes {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		require.NoError(t, os.WriteFile(p, make([]byte, size), 0640))
+		expectTotal += int64(size)
+	}
+
+	var lastDone, lastTotal int64
+	calls := map[string]int{}
+	progress := func(entry string, done, total int64) {
+		require.GreaterOrEqual(t, done, lastDone, "progress went backwards")
+		lastDone = done
+		lastTotal = total
+		calls[entry]++
+	}
+
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithProgress(progress)))
+	require.Equal(t, expectTotal, lastTotal)
+	require.Equal(t, expectTotal, lastDone)
+	require.Len(t, calls, len(sizes))
+	// Large file reported periodically.
+	require.Greater(t, calls["src/big.bin"], 2)
+
+	// Total is not known when extracting.
+	lastDone = 0
+	calls = map[string]int{}
+	require.NoError(t, targz.Extract(tarPath, t.TempDir(), targz.WithProgress(progress)))
+	require.Equal(t, int64(-1), lastTotal)
+	require.Equal(t, expectTotal, lastDone)
+	require.Len(t, calls, len(sizes))
+	require.Greater(t, calls["src/big.bin"], 2)
+}
+
+func TestProgressNameTransform(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.bin"), make([]byte, 3000), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "drop.bin"), make([]byte, 5000), 0640))
+
+	var lastDone, lastTotal int64
+	progress := func(_ string, done, total int64) {
+		lastDone = done
+		lastTotal = total
+	}
+	dropFile := func(name string) (string, bool) {
+		return name, name != "src/sub/drop.bin"
+	}
+	tarPath := filepath.Join(t.TempDir(), "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithProgress(progress), targz.WithNameTransform(dropFile)))
+	require.Equal(t, int64(8000), lastTotal)
+	require.Equal(t, lastTotal, lastDone)
+
+	entries, err := targz.List(tarPath)
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NotEqual(t, "src/sub/drop.bin", e.Name)
+	}
+}
@@ -0,0 +1,126 @@
+package targz
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// QuarantinedEntry describes an archive entry that failed a safety check
+// during extraction, and was written to the quarantine directory instead of
+// the target directory.
+type QuarantinedEntry struct {
+	// Name is the name of the entry in the archive.
+	Name string
+	// Path is where the entry was written in the quarantine directory. This is
+	// empty if the entry has no content to write, such as a link.
+	Path string
+	// Reason describes why the entry is unsafe.
+	Reason string
+}
+
+// unsafeReason returns the reason that the entry is not safe to extract, or an
+// empty string if it is safe. If allowLinks is true, then symbolic links to
+// outside of the target directory are allowed.
+func unsafeReason(header *tar.Header, allowLinks bool) string {
+	if reason := unsafeName(header.Name); reason != "" {
+		return "name " + reason
+	}
+	switch header.Typeflag {
+	case tar.TypeLink:
+		if reason := unsafeName(header.Linkname); reason != "" {
+			return "link target " + reason
+		}
+	case tar.TypeSymlink:
+		if !allowLinks && symlinkEscapes(header.Name, header.Linkname) {
+			return "symbolic link target is outside of target directory"
+		}
+	}
+	return ""
+}
+
+// unsafeName returns the reason that name is not a safe archive path, or an
+// empty string if it is safe.
+func unsafeName(name string) string {
+	slashName := filepath.ToSlash(name)
+	clean := path.Clean(slashName)
+	switch {
+	case name == "":
+		return "is empty"
+	case strings.ContainsRune(name, 0):
+		return "contains NUL character"
+	case path.IsAbs(slashName) || filepath.IsAbs(name) || filepath.VolumeName(name) != "":
+		return "is absolute"
+	case clean == ".." || strings.HasPrefix(clean, "../"):
+		return "is outside of target directory"
+	}
+	return ""
+}
+
+// sanitizeName returns a relative name, made from name, that is within the
+// quarantine directory.
+func sanitizeName(name string) string {
+	name = strings.ReplaceAll(filepath.ToSlash(name), "\x00", "_")
+	name = strings.TrimPrefix(name, filepath.VolumeName(name))
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// quarantinePath returns the path in the quarantine directory that the unsafe
+// entry, described by header, is written to. Entries with no safe name are
+// numbered in the order they are quarantined.
+func (x *extractor) quarantinePath(header *tar.Header) string {
+	name := sanitizeName(header.Name)
+	if name == "" {
+		name = fmt.Sprintf("entry-%d", len(x.quarantined)+1)
+	}
+	return filepath.Join(x.opts.quarantineDir, filepath.FromSlash(name))
+}
+
+// quarantine writes the unsafe entry, described by header, under the
+// quarantine directory instead of the target directory.
+func (x *extractor) quarantine(header *tar.Header, r io.Reader, reason string) error {
+	entry := QuarantinedEntry{
+		Name:   header.Name,
+		Reason: reason,
+	}
+	target := x.quarantinePath(header)
+	mode := header.FileInfo().Mode()
+
+	switch {
+	case header.Typeflag == tar.TypeLink, header.Typeflag == tar.TypeSymlink:
+		// Link is not created, since its target is not known to be safe.
+	case isDirEntry(header):
+		if err := os.MkdirAll(target, x.defaultDirMode()); err != nil {
+			return err
+		}
+		entry.Path = target
+	case mode.IsRegular():
+		if err := os.MkdirAll(filepath.Dir(target), x.defaultDirMode()); err != nil {
+			return err
+		}
+		f, err := x.openFile(target, mode.Perm())
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+		entry.Path = target
+	}
+	x.quarantined = append(x.quarantined, entry)
+	return nil
+}
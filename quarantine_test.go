@@ -0,0 +1,82 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantine(t *testing.T) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	writeEntry := func(name, content string) {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0640,
+			Size:     int64(len(content)),
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	writeEntry("safe/a.txt", "a")
+	writeEntry("../escape.txt", "escape")
+	writeEntry("/abs/b.txt", "abs")
+	writeEntry("safe/../../up.txt", "up")
+	writeEntry("safe/./c.txt", "c")
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeLink,
+		Name:     "safe/link.txt",
+		Linkname: "../../escape.txt",
+	}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	tmpDir := t.TempDir()
+	outDir := filepath.Join(tmpDir, "out")
+	quarantineDir := filepath.Join(tmpDir, "quarantine")
+	var report []targz.QuarantinedEntry
+	err := targz.ExtractReader(&buf, outDir, targz.WithQuarantine(quarantineDir, func(entries []targz.QuarantinedEntry) {
+		report = entries
+	}))
+	require.NoError(t, err)
+
+	// Safe entries are extracted normally.
+	for name, content := range map[string]string{"safe/a.txt": "a", "safe/c.txt": "c"} {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+	_, err = os.Lstat(filepath.Join(outDir, "safe", "link.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Unsafe entries are in quarantine, and not outside of it.
+	for name, content := range map[string]string{"escape.txt": "escape", "abs/b.txt": "abs", "safe/up.txt": "up"} {
+		data, err := os.ReadFile(filepath.Join(quarantineDir, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+	for _, name := range []string{"escape.txt", "up.txt"} {
+		_, err = os.Stat(filepath.Join(tmpDir, name))
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+
+	require.Len(t, report, 4)
+	names := make([]string, len(report))
+	for i, entry := range report {
+		names[i] = entry.Name
+		require.NotEmpty(t, entry.Reason)
+	}
+	require.Equal(t, []string{"../escape.txt", "/abs/b.txt", "safe/../../up.txt", "safe/link.txt"}, names)
+	require.Equal(t, filepath.Join(quarantineDir, "escape.txt"), report[0].Path)
+	require.Contains(t, report[1].Reason, "absolute")
+	require.Contains(t, report[3].Reason, "link target")
+	require.Empty(t, report[3].Path)
+}
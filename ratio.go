@@ -0,0 +1,64 @@
+package targz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrFileRatio is returned when a file in an archive expands, when
+// decompressed, by more than the ratio set by WithMaxFileRatio.
+var ErrFileRatio = errors.New("file expansion ratio exceeds limit")
+
+// minRatioCompressed is the least number of compressed bytes attributed to a
+// file. Compressed data is read ahead in blocks of about this size, so a file
+// may be decompressed entirely from data that was already read.
+const minRatioCompressed = 4096
+
+// compressedCounter counts the compressed bytes read from an archive.
+type compressedCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *compressedCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countCompressed returns a reader that counts the compressed bytes read from
+// r, if the extraction options limit the file expansion ratio or record stats.
+// Otherwise r is returned.
+func countCompressed(r io.Reader, opts *config) io.Reader {
+	if opts.maxFileRatio <= 0 && opts.stats == nil {
+		return r
+	}
+	opts.compressed = &compressedCounter{r: r}
+	return opts.compressed
+}
+
+// ratioReader reads the data of a single file, and returns ErrFileRatio if the
+// data read is larger, by more than the maximum ratio, than the compressed
+// data consumed since the file started.
+type ratioReader struct {
+	r          io.Reader
+	name       string
+	compressed *compressedCounter
+	start      int64
+	maxRatio   float64
+	n          int64
+}
+
+func (r *ratioReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	consumed := r.compressed.n - r.start
+	if consumed < minRatioCompressed {
+		consumed = minRatioCompressed
+	}
+	if ratio := float64(r.n) / float64(consumed); ratio > r.maxRatio {
+		return n, fmt.Errorf("%w: %s expanded %.0f times", ErrFileRatio, r.name, ratio)
+	}
+	return n, err
+}
@@ -0,0 +1,51 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxFileRatio(t *testing.T) {
+	random := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, targz.WriteFile(tw, "data/small.txt", []byte("small"), 0640, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "data/random.bin", random, 0640, time.Now()))
+	require.NoError(t, targz.WriteFile(tw, "data/zeros.bin", make([]byte, 16<<20), 0640, time.Now()))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	archive := buf.Bytes()
+
+	// Without limit, archive extracts.
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir))
+
+	outDir = t.TempDir()
+	err := targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithMaxFileRatio(100))
+	require.ErrorIs(t, err, targz.ErrFileRatio)
+	require.ErrorContains(t, err, "data/zeros.bin")
+	// Partial output of the bomb is removed.
+	_, err = os.Lstat(filepath.Join(outDir, "data", "zeros.bin"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Files before the bomb are extracted.
+	data, err := os.ReadFile(filepath.Join(outDir, "data", "random.bin"))
+	require.NoError(t, err)
+	require.Equal(t, random, data)
+
+	// Ratio that is high enough allows extraction.
+	outDir = t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir, targz.WithMaxFileRatio(5000)))
+}
@@ -0,0 +1,206 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// fileJob is a regular file, at an offset in an uncompressed tar archive, to
+// extract to a target path.
+type fileJob struct {
+	header *tar.Header
+	target string
+	offset int64
+}
+
+// ExtractReaderAt extracts an uncompressed tar archive, read from r, into the
+// target directory. The size is the number of bytes of archive data in r.
+//
+// Since the data of each file in an uncompressed archive can be read
+// independently, the headers of all entries are read first, and then the
+// files are extracted concurrently by multiple goroutines. Directories are
+// created before any files are extracted, and links are created after all
+// files are extracted.
+//
+// The WithProgress and WithDirCompleteHook options are not supported, since
+// files are not extracted in archive order. WithMaxFileRatio has no effect,
+// since the archive is not compressed. An error is returned if the archive is
+// gzip compressed.
+func ExtractReaderAt(r io.ReaderAt, size int64, targetDir string, options ...Option) error {
+	opts := getOpts(options)
+	opts.progressFunc = nil
+	opts.dirCompleteHook = nil
+	opts.maxFileRatio = 0
+
+	sr := io.NewSectionReader(r, 0, size)
+	magic := make([]byte, len(gzipMagic))
+	if _, err := sr.ReadAt(magic, 0); err == nil && bytes.Equal(magic, gzipMagic) {
+		return errors.New("cannot concurrently extract gzip compressed archive")
+	}
+
+	x := newExtractor(targetDir, &opts)
+	if opts.cleanTarget {
+		if err := cleanDir(x.targetDir); err != nil {
+			return err
+		}
+	}
+
+	// Read headers and create directories. Files are queued to extract
+	// concurrently, and links are extracted after files.
+	var files []fileJob
+	queued := map[string]int{}
+	var links []*tar.Header
+	tr := tar.NewReader(sr)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return x.readError(err)
+		}
+		if err = opts.ctxErr(); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if !opts.selectEntry(header) {
+			continue
+		}
+		if header.Typeflag == tar.TypeLink || header.Typeflag == tar.TypeSymlink {
+			links = append(links, header)
+			continue
+		}
+		target, write, err := x.prepareEntry(header, tr)
+		if err != nil {
+			return err
+		}
+		if !write {
+			continue
+		}
+		if isDirEntry(header) || !header.FileInfo().Mode().IsRegular() || isSparse(header) {
+			if err = x.writeEntry(header, target, tr); err != nil {
+				return x.readError(err)
+			}
+			continue
+		}
+		offset, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		job := fileJob{
+			header: header,
+			target: target,
+			offset: offset,
+		}
+		// A later entry for the same path replaces an earlier one.
+		if i, found := queued[target]; found {
+			files[i] = job
+			continue
+		}
+		queued[target] = len(files)
+		files = append(files, job)
+	}
+
+	if err := x.extractFiles(r, files); err != nil {
+		return err
+	}
+
+	for _, header := range links {
+		if err := x.extractEntry(header, nil); err != nil {
+			return err
+		}
+	}
+	if opts.materializeSymlinks {
+		if err := x.materializeLinks(); err != nil {
+			return err
+		}
+	}
+	if opts.postFixPerms {
+		if err := x.fixPermissions(); err != nil {
+			return err
+		}
+	}
+	if err := x.restoreDirTimes(); err != nil {
+		return err
+	}
+	if opts.quarantineReport != nil {
+		opts.quarantineReport(x.quarantined)
+	}
+	return nil
+}
+
+// extractFiles extracts the files concurrently, reading the data of each file
+// from r.
+func (x *extractor) extractFiles(r io.ReaderAt, files []fileJob) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	jobs := make(chan fileJob)
+	var mutex sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		// Each worker has its own extractor state, which is merged when the
+		// worker is done.
+		w := &extractor{
+			targetDir: x.targetDir,
+			opts:      x.opts,
+			openFile:  x.openFile,
+			isRoot:    x.isRoot,
+			extracted: x.extracted,
+		}
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				data := io.NewSectionReader(r, job.offset, job.header.Size)
+				err := w.writeEntry(job.header, job.target, data)
+				mutex.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mutex.Unlock()
+			}
+			mutex.Lock()
+			x.count += w.count
+			x.permFixes = append(x.permFixes, w.permFixes...)
+			mutex.Unlock()
+		}()
+	}
+
+	for _, job := range files {
+		mutex.Lock()
+		err := firstErr
+		mutex.Unlock()
+		if err != nil {
+			break
+		}
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// isSparse returns true if the entry is a sparse file, the data of which is
+// not stored contiguously in the archive.
+func isSparse(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
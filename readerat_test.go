@@ -0,0 +1,106 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+// largeTar returns an uncompressed tar archive containing directories of
+// files with random content, and a map of file name to content.
+func largeTar(t testing.TB, dirs, filesPerDir, fileSize int) ([]byte, map[string][]byte) {
+	rnd := rand.New(rand.NewSource(1))
+	files := map[string][]byte{}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for d := 0; d < dirs; d++ {
+		dir := fmt.Sprintf("top/dir%02d/", d)
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     dir,
+			Mode:     0750,
+		}))
+		for f := 0; f < filesPerDir; f++ {
+			name := fmt.Sprintf("%sfile%03d.bin", dir, f)
+			data := make([]byte, fileSize+rnd.Intn(fileSize))
+			rnd.Read(data)
+			require.NoError(t, targz.WriteFile(tw, name, data, 0640, time.Now()))
+			files[name] = data
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes(), files
+}
+
+func TestExtractReaderAt(t *testing.T) {
+	archive, files := largeTar(t, 8, 16, 64*1024)
+
+	// Add a hard link and a duplicate entry, which replaces the earlier one.
+	var buf bytes.Buffer
+	buf.Write(archive[:len(archive)-1024])
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, targz.WriteFile(tw, "top/dir00/file000.bin", []byte("replaced"), 0640, time.Now()))
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeLink,
+		Name:     "top/link.bin",
+		Linkname: "top/dir01/file001.bin",
+		Mode:     0640,
+	}))
+	require.NoError(t, tw.Close())
+	archive = buf.Bytes()
+	files["top/dir00/file000.bin"] = []byte("replaced")
+	files["top/link.bin"] = files["top/dir01/file001.bin"]
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReaderAt(bytes.NewReader(archive), int64(len(archive)), outDir))
+	for name, data := range files {
+		got, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.Equal(t, data, got, name)
+	}
+	entries, err := os.ReadDir(filepath.Join(outDir, "top"))
+	require.NoError(t, err)
+	require.Len(t, entries, 9)
+
+	// Expansion ratio is not limited, since the archive is not compressed.
+	err = targz.ExtractReaderAt(bytes.NewReader(archive), int64(len(archive)), t.TempDir(), targz.WithMaxFileRatio(1))
+	require.NoError(t, err)
+
+	// Truncated archive.
+	truncated := archive[:len(archive)/2]
+	err = targz.ExtractReaderAt(bytes.NewReader(truncated), int64(len(truncated)), t.TempDir())
+	require.ErrorIs(t, err, targz.ErrTruncatedArchive)
+
+	// Compressed archive is not supported.
+	srcDir := filepath.Join(outDir, "top")
+	buf.Reset()
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	err = targz.ExtractReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()), t.TempDir())
+	require.ErrorContains(t, err, "gzip")
+}
+
+func BenchmarkExtractReaderAt(b *testing.B) {
+	archive, _ := largeTar(b, 16, 32, 256*1024)
+	b.SetBytes(int64(len(archive)))
+
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := targz.ExtractReader(bytes.NewReader(archive), b.TempDir())
+			require.NoError(b, err)
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := targz.ExtractReaderAt(bytes.NewReader(archive), int64(len(archive)), b.TempDir())
+			require.NoError(b, err)
+		}
+	})
+}
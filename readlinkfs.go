@@ -0,0 +1,17 @@
+//go:build go1.25
+
+package targz
+
+import "io/fs"
+
+// canReadLink returns true if the targets of symbolic links in fsys can be
+// read.
+func canReadLink(fsys fs.FS) bool {
+	_, ok := fsys.(fs.ReadLinkFS)
+	return ok
+}
+
+// readLinkFS returns the target of the symbolic link at path name in fsys.
+func readLinkFS(fsys fs.FS, name string) (string, error) {
+	return fs.ReadLink(fsys, name)
+}
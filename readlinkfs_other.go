@@ -0,0 +1,28 @@
+//go:build !go1.25
+
+package targz
+
+import "io/fs"
+
+// readLinker is a file system that can read the targets of symbolic links. It
+// has the same method as fs.ReadLinkFS, which is not available before Go 1.25.
+type readLinker interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// canReadLink returns true if the targets of symbolic links in fsys can be
+// read.
+func canReadLink(fsys fs.FS) bool {
+	_, ok := fsys.(readLinker)
+	return ok
+}
+
+// readLinkFS returns the target of the symbolic link at path name in fsys.
+func readLinkFS(fsys fs.FS, name string) (string, error) {
+	rl, ok := fsys.(readLinker)
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return rl.ReadLink(name)
+}
@@ -0,0 +1,145 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxResolveLinks is the most symbolic links followed to resolve a path.
+const maxResolveLinks = 255
+
+// resolveOnDisk returns the path that p refers to on disk, following symbolic
+// links in the parts of p that exist. The parts of p that do not exist are
+// added as they are. Unlike filepath.EvalSymlinks, p is not cleaned before it
+// is resolved, so that ".." following a link refers to the parent of the link
+// target, as it does when the path is used.
+func resolveOnDisk(p string) (string, error) {
+	p = filepath.FromSlash(p)
+	if !filepath.IsAbs(p) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		p = wd + string(filepath.Separator) + p
+	}
+	vol := filepath.VolumeName(p)
+	dest := vol + string(filepath.Separator)
+	rest := p[len(vol):]
+	var links int
+	var missing bool
+	for rest != "" {
+		var elem string
+		rest = strings.TrimLeft(rest, string(filepath.Separator))
+		elem, rest, _ = strings.Cut(rest, string(filepath.Separator))
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			dest = filepath.Dir(dest)
+			continue
+		}
+		next := filepath.Join(dest, elem)
+		if missing {
+			dest = next
+			continue
+		}
+		fi, err := os.Lstat(next)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+			missing = true
+			dest = next
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			dest = next
+			continue
+		}
+		if links++; links > maxResolveLinks {
+			return "", fmt.Errorf("too many links resolving %s", p)
+		}
+		link, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		link = filepath.FromSlash(link)
+		if filepath.IsAbs(link) {
+			vol = filepath.VolumeName(link)
+			dest = vol + string(filepath.Separator)
+			link = link[len(vol):]
+		}
+		rest = link + string(filepath.Separator) + rest
+	}
+	return dest, nil
+}
+
+// checkResolved returns an error if writing the entry at target would write
+// outside of the target directory by following symbolic links that are on
+// disk, such as links extracted from earlier entries. The names in the archive
+// do not show where these links lead, so a chain of links that each appear to
+// stay within the target directory can lead outside of it.
+//
+// The directory that contains target must resolve to within the target
+// directory, as must target itself for a regular file, since the file is
+// opened through any link at target. The target of a hard link must also
+// resolve to within the target directory, as must the target of a symbolic
+// link unless escaping links are allowed.
+func (x *extractor) checkResolved(header *tar.Header, target string) error {
+	if x.resolvedTarget == "" {
+		root, err := resolveOnDisk(x.targetDir)
+		if err != nil {
+			return err
+		}
+		x.resolvedTarget = root
+	}
+
+	parent, err := resolveOnDisk(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	if !withinDir(x.resolvedTarget, parent) {
+		return fmt.Errorf("%w: entry %q is in a linked directory", ErrOutsideTarget, header.Name)
+	}
+
+	switch {
+	case header.Typeflag == tar.TypeLink:
+		linkTarget, err := resolveOnDisk(filepath.Join(x.targetDir, filepath.FromSlash(header.Linkname)))
+		if err != nil {
+			return err
+		}
+		if !withinDir(x.resolvedTarget, linkTarget) {
+			return fmt.Errorf("%w: entry %q links to %q", ErrOutsideTarget, header.Name, header.Linkname)
+		}
+	case header.Typeflag == tar.TypeSymlink:
+		if x.opts.allowEscapingLinks {
+			return nil
+		}
+		// A relative link target is relative to the directory containing the
+		// link.
+		linkname := filepath.FromSlash(header.Linkname)
+		if !filepath.IsAbs(linkname) {
+			linkname = parent + string(filepath.Separator) + linkname
+		}
+		linkTarget, err := resolveOnDisk(linkname)
+		if err != nil {
+			return err
+		}
+		if !withinDir(x.resolvedTarget, linkTarget) {
+			return fmt.Errorf("%w: %s links to %s", ErrEscapingLink, header.Name, header.Linkname)
+		}
+	case !isDirEntry(header):
+		resolved, err := resolveOnDisk(target)
+		if err != nil {
+			return err
+		}
+		if !withinDir(x.resolvedTarget, resolved) {
+			return fmt.Errorf("%w: entry %q is a link", ErrOutsideTarget, header.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package targz
+
+import (
+	"archive/tar"
+	"io"
+)
+
+// Stats summarizes the entries processed by creating or extracting an
+// archive.
+type Stats struct {
+	// FileCount is the number of regular files, including hard links.
+	FileCount int
+	// DirCount is the number of directories.
+	DirCount int
+	// SymlinkCount is the number of symbolic links.
+	SymlinkCount int
+	// TotalBytes is the total uncompressed size of regular file data.
+	TotalBytes int64
+	// CompressedBytes is the number of archive bytes written when creating,
+	// or read when extracting.
+	CompressedBytes int64
+}
+
+// add counts the entry described by the header.
+func (s *Stats) add(hdr *tar.Header) {
+	switch {
+	case isDirEntry(hdr):
+		s.DirCount++
+	case hdr.Typeflag == tar.TypeSymlink:
+		s.SymlinkCount++
+	case hdr.Typeflag == tar.TypeLink, hdr.FileInfo().Mode().IsRegular():
+		s.FileCount++
+		s.TotalBytes += hdr.Size
+	}
+}
+
+// CreateWithStats creates a gzip compressed tar file, the same as Create, and
+// returns a summary of the archived entries.
+func CreateWithStats(dir, tarPath string, options ...Option) (Stats, error) {
+	var stats Stats
+	err := Create(dir, tarPath, append(options, withStats(&stats))...)
+	return stats, err
+}
+
+// ExtractWithStats extracts a gzip compressed tar file, the same as Extract,
+// and returns a summary of the extracted entries.
+func ExtractWithStats(tarPath, targetDir string, options ...Option) (Stats, error) {
+	var stats Stats
+	err := Extract(tarPath, targetDir, append(options, withStats(&stats))...)
+	return stats, err
+}
+
+// withStats sets where stats are recorded.
+func withStats(stats *Stats) Option {
+	return func(c *config) {
+		c.stats = stats
+	}
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,35 @@
+package targz_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "a", "b"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "one.txt"), []byte("12345"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "two.txt"), []byte("1234567890"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a", "b", "three.txt"), []byte("123"), 0640))
+
+	tarPath := filepath.Join(t.TempDir(), "src.tar.gz")
+	stats, err := targz.CreateWithStats(srcDir, tarPath)
+	require.NoError(t, err)
+	fi, err := os.Stat(tarPath)
+	require.NoError(t, err)
+	want := targz.Stats{
+		FileCount:       3,
+		DirCount:        3,
+		TotalBytes:      18,
+		CompressedBytes: fi.Size(),
+	}
+	require.Equal(t, want, stats)
+
+	stats, err = targz.ExtractWithStats(tarPath, t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, want, stats)
+}
@@ -0,0 +1,83 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractSubtree extracts only the entries under the directory archivePrefix
+// in the archive file, so that the contents of that directory are at the root
+// of the target directory. For example, extracting the prefix "repo/module"
+// writes the archive entry "repo/module/a/b.txt" to "a/b.txt" in the target
+// directory.
+//
+// Hard links to files outside of the subtree are skipped with a warning, and
+// symbolic links that refer outside of the subtree are treated as escaping the
+// target directory.
+func ExtractSubtree(tarPath, archivePrefix, targetDir string, options ...Option) error {
+	prefix := path.Clean(strings.Trim(filepath.ToSlash(archivePrefix), "/"))
+	if prefix == "." || prefix == ".." || strings.HasPrefix(prefix, "../") {
+		return fmt.Errorf("invalid archive prefix %q", archivePrefix)
+	}
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	opts := getOpts(options)
+	filter := opts.extractFilter
+	opts.extractFilter = func(header *tar.Header) bool {
+		if !opts.trimSubtree(header, prefix) {
+			return false
+		}
+		return filter == nil || filter(header)
+	}
+
+	rc, err := decompressReader(countCompressed(f, &opts), &opts)
+	if err != nil {
+		if errors.Is(err, ErrEmptyArchive) && opts.allowEmpty {
+			return nil
+		}
+		return err
+	}
+	defer rc.Close()
+	return extractTar(rc, targetDir, &opts)
+}
+
+// trimSubtree removes the prefix from the name of an entry under the prefix
+// directory. Returns false if the entry is not extracted from the subtree.
+func (c *config) trimSubtree(header *tar.Header, prefix string) bool {
+	name, ok := trimPrefixDir(header.Name, prefix)
+	if !ok {
+		return false
+	}
+	if header.Typeflag == tar.TypeLink {
+		linkname, ok := trimPrefixDir(header.Linkname, prefix)
+		if !ok {
+			c.warn(fmt.Sprintf("skipping %s: links to %s outside of %s", header.Name, header.Linkname, prefix))
+			return false
+		}
+		header.Linkname = linkname
+	}
+	header.Name = name
+	return true
+}
+
+// trimPrefixDir returns the name relative to the prefix directory. Returns
+// false if the name is not within the prefix directory, or is the prefix
+// directory itself.
+func trimPrefixDir(name, prefix string) (string, bool) {
+	name = strings.TrimPrefix(name, "./")
+	rest, ok := strings.CutPrefix(name, prefix+"/")
+	if !ok || strings.Trim(rest, "/") == "" {
+		return "", false
+	}
+	return rest, true
+}
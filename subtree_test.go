@@ -0,0 +1,51 @@
+package targz_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractSubtree(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "repo")
+	for name, data := range map[string]string{
+		"top.txt":                   "top",
+		"modules/a/main.go":         "a",
+		"modules/b/main.go":         "b",
+		"modules/b/internal/lib.go": "lib",
+		"modules/bb/other.go":       "bb",
+	} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(data), 0640))
+	}
+	tarPath := filepath.Join(t.TempDir(), "repo.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractSubtree(tarPath, "repo/modules/b/", outDir))
+
+	var files []string
+	err := filepath.WalkDir(outDir, func(p string, d os.DirEntry, err error) error {
+		require.NoError(t, err)
+		if !d.IsDir() {
+			rel, err := filepath.Rel(outDir, p)
+			require.NoError(t, err)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"main.go", "internal/lib.go"}, files)
+
+	data, err := os.ReadFile(filepath.Join(outDir, "internal", "lib.go"))
+	require.NoError(t, err)
+	require.Equal(t, "lib", string(data))
+
+	// Prefix must be within archive.
+	require.Error(t, targz.ExtractSubtree(tarPath, "../repo", t.TempDir()))
+	require.Error(t, targz.ExtractSubtree(tarPath, "/", t.TempDir()))
+}
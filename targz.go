@@ -3,32 +3,50 @@ package targz
 import (
 	"archive/tar"
 	"bufio"
-	"compress/gzip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
 	"os"
-	"os/user"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 )
 
 // Create creates a gzip compressed tar file containing the contents of the
 // specified directory.
 //
+// A relative directory path is interpreted relative to the current directory,
+// or relative to the directory given by WithBaseDir.
+//
 // If the directory to archive is specified by a path such as
 // "/tmp/myfiles/backups/weekly", then only the "weekly" directory, and none of
 // its parent path, is added to the tar archive. When extracted, a "weekly"
 // directory is created with all of its archived contents.
+//
+// Entries are written in a stable order: depth-first, with the entries in each
+// directory in lexical order of their names, and each subdirectory written
+// immediately before its contents. Archives of the same directory tree
+// therefore list their entries in the same order.
+//
+// Archiving the current directory is an error, unless allowed by the
+// WithAllowCurrentDir option, since the archive file is typically written to
+// the current directory.
 func Create(dir, tarPath string, options ...Option) error {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-	dir = filepath.Clean(dir)
-	if dir == "" || dir == "." || dir == cwd {
-		return errors.New("cannot archive current directory")
+	opts := getOpts(options)
+	if !opts.allowCurrentDir {
+		isCwd, err := isCurrentDir(opts.resolvePath(dir))
+		if err != nil {
+			return err
+		}
+		if isCwd {
+			return errors.New("cannot archive current directory")
+		}
 	}
 	tarfile, err := os.Create(tarPath)
 	if err != nil {
@@ -42,238 +60,975 @@ func Create(dir, tarPath string, options ...Option) error {
 	return tarfile.Close()
 }
 
+// isCurrentDir returns true if dir is the current directory. This compares
+// the directories' device and inode, so that any path that resolves to the
+// current directory, such as through a symlink, is detected.
+func isCurrentDir(dir string) (bool, error) {
+	fi, err := os.Stat(filepath.Clean(dir))
+	if err != nil {
+		// Let archive creation report the error.
+		return false, nil
+	}
+	cwdInfo, err := os.Stat(".")
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(fi, cwdInfo), nil
+}
+
 // Create writes a gzip compressed tar file to an io.Writer. The tar file
 // contains the contents of the specified directory.
 func CreateWriter(dir string, w io.Writer, options ...Option) error {
 	opts := getOpts(options)
+	return writeArchive(w, &opts, nil, func(tw *tar.Writer) error {
+		return tarAddDir(dir, &opts, tw)
+	})
+}
 
-	wr := bufio.NewWriter(w)
+// writeArchive writes a gzip compressed tar file to w. If there are any global
+// PAX records, from the global argument or from the options, then these are
+// written in a global header at the start of the archive. The rest of the tar
+// content is written by the add function.
+func writeArchive(w io.Writer, opts *config, global map[string]string, add func(*tar.Writer) error) error {
+	aw, err := newArchiveWriter(w, opts, global)
+	if err != nil {
+		return err
+	}
+	if err = add(aw.tw); err != nil {
+		aw.abort()
+		return err
+	}
+	return aw.close()
+}
+
+// archiveWriter holds the writers that produce a gzip compressed tar file.
+type archiveWriter struct {
+	tw  *tar.Writer
+	gzw io.WriteCloser
+	fw  *footerWriter
+	wr  *bufio.Writer
+}
+
+// newArchiveWriter returns an archiveWriter that writes to w, after writing
+// any global header. See writeArchive.
+func newArchiveWriter(w io.Writer, opts *config, global map[string]string) (*archiveWriter, error) {
+	if err := opts.checkOwner(); err != nil {
+		return nil, err
+	}
+	if opts.stats != nil {
+		w = &countWriter{w: w, n: &opts.stats.CompressedBytes}
+	}
+	aw := &archiveWriter{
+		wr: bufio.NewWriter(w),
+	}
+
+	// Compressed data is hashed for the integrity footer.
+	var cw io.Writer = aw.wr
+	if opts.integrityFooter {
+		aw.fw = newFooterWriter(aw.wr, opts.codec)
+		cw = aw.fw
+	}
+	// Buffered data is flushed after each sync interval.
+	if opts.syncInterval > 0 {
+		cw = &syncWriter{
+			w:        cw,
+			flush:    aw.wr.Flush,
+			interval: opts.syncInterval,
+		}
+	}
 
 	// gzip writer writes to buffer.
-	gzw := gzip.NewWriter(wr)
-	defer gzw.Close()
+	var err error
+	aw.gzw, err = newCompressor(cw, opts)
+	if err != nil {
+		return nil, err
+	}
 	// tar writer writes to gzip.
-	tw := tar.NewWriter(gzw)
-	defer tw.Close()
+	aw.tw = tar.NewWriter(aw.gzw)
 
-	err := tarAddDir(dir, opts.ignores, tw)
-	if err != nil {
-		return err
+	if opts.stampCreationTime {
+		if global == nil {
+			global = map[string]string{}
+		}
+		global[paxCreated] = formatPAXTime(time.Now())
 	}
+	if opts.schemaVersion != "" {
+		if global == nil {
+			global = map[string]string{}
+		}
+		global[paxSchema] = opts.schemaVersion
+	}
+	if len(global) != 0 {
+		err = aw.tw.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeXGlobalHeader,
+			PAXRecords: global,
+		})
+		if err != nil {
+			aw.abort()
+			return nil, err
+		}
+	}
+	return aw, nil
+}
 
+// close finishes writing the archive and flushes all data to the writer.
+func (aw *archiveWriter) close() error {
 	// Close tar writer; flush tar data to gzip writer
-	if err = tw.Close(); err != nil {
+	if err := aw.tw.Close(); err != nil {
 		return err
 	}
 	// Close gzip writer; finish writing gzip data to buffer.
-	if err = gzw.Close(); err != nil {
+	if err := aw.gzw.Close(); err != nil {
 		return err
 	}
+	if aw.fw != nil {
+		if err := aw.fw.writeFooter(); err != nil {
+			return err
+		}
+	}
 	// Flush buffered data to writer.
-	return wr.Flush()
+	return aw.wr.Flush()
+}
+
+// abort releases the writers, after an error, without completing the archive.
+func (aw *archiveWriter) abort() {
+	aw.tw.Close()
+	aw.gzw.Close()
+}
+
+// syncWriter calls flush after each interval of bytes written through it.
+type syncWriter struct {
+	w        io.Writer
+	flush    func() error
+	interval int64
+	pending  int64
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	sw.pending += int64(n)
+	if err == nil && sw.pending >= sw.interval {
+		sw.pending = 0
+		err = sw.flush()
+	}
+	return n, err
+}
+
+// CreateMulti creates a gzip compressed tar file containing the contents of
+// each of the specified directories. Each directory is archived as Create
+// archives a single directory, so that the base name of each directory is a
+// top-level entry in the archive. An error is returned if more than one of the
+// directories has the same base name.
+func CreateMulti(dirs []string, tarPath string, options ...Option) error {
+	opts := getOpts(options)
+	names := map[string]string{}
+	for _, dir := range dirs {
+		if !opts.allowCurrentDir {
+			isCwd, err := isCurrentDir(opts.resolvePath(dir))
+			if err != nil {
+				return err
+			}
+			if isCwd {
+				return errors.New("cannot archive current directory")
+			}
+		}
+		absDir, err := filepath.Abs(opts.resolvePath(dir))
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(absDir)
+		if opts.baseName != "" {
+			name = opts.baseName
+		}
+		if other, found := names[name]; found {
+			return fmt.Errorf("directories %s and %s have the same name %q", other, dir, name)
+		}
+		names[name] = dir
+	}
+
+	tarfile, err := os.Create(tarPath)
+	if err != nil {
+		return err
+	}
+	err = writeArchive(tarfile, &opts, nil, func(tw *tar.Writer) error {
+		// Report progress of all directories together.
+		paths := make([]string, len(dirs))
+		for i, dir := range dirs {
+			paths[i] = opts.resolvePath(dir)
+		}
+		progress, err := newCreateProgress(paths, &opts)
+		if err != nil {
+			return err
+		}
+		opts.progress = progress
+
+		for _, dir := range dirs {
+			if err := tarAddDir(dir, &opts, tw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tarfile.Close()
+		return err
+	}
+	return tarfile.Close()
+}
+
+// CreateReader returns an io.ReadCloser from which a gzip compressed tar file,
+// containing the contents of the specified directory, is read.
+//
+// The archive is written by a separate goroutine into a buffer of limited
+// size, see WithPipeBufferSize. When the buffer is full the archiving
+// goroutine blocks until the reader consumes data, so memory use does not
+// grow with the size of the archive. Any error that occurs while creating the
+// archive is returned by Read. Closing the reader before all data is read
+// stops the archiving goroutine.
+func CreateReader(dir string, options ...Option) io.ReadCloser {
+	opts := getOpts(options)
+	bufSize := opts.pipeBufSize
+	if bufSize <= 0 {
+		bufSize = defaultPipeBufSize
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		bw := bufio.NewWriterSize(pw, bufSize)
+		err := CreateWriter(dir, bw, options...)
+		if err == nil {
+			err = bw.Flush()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
 }
 
 // tarAddDir recursively writes all files and subdirectories to the tar writer.
-func tarAddDir(dir string, ignores []string, tw *tar.Writer) error {
-	dir = strings.TrimRight(dir, string(filepath.Separator))
-	parent := filepath.Dir(dir)
-	dir = filepath.Base(dir)
-	if parent != "." {
-		cwd, err := os.Getwd()
+func tarAddDir(dir string, opts *config, tw *tar.Writer) error {
+	if err := opts.checkOwner(); err != nil {
+		return err
+	}
+	if opts.progress == nil {
+		progress, err := newCreateProgress([]string{opts.resolvePath(dir)}, opts)
 		if err != nil {
 			return err
 		}
-		if err = os.Chdir(parent); err != nil {
+		opts.progress = progress
+	}
+
+	parent, dir, err := splitParent(opts.resolvePath(dir))
+	if err != nil {
+		return err
+	}
+
+	name, err := opts.rootName(dir)
+	if err != nil {
+		return err
+	}
+	a := newArchiver(tw, opts, name)
+	addEntry := a.addEntry
+	if name != dir {
+		// Replace directory name at the start of each entry name.
+		prefix := filepath.ToSlash(dir)
+		addEntry = func(e archiveEntry) error {
+			e.name = name + strings.TrimPrefix(e.name, prefix)
+			return a.addEntry(e)
+		}
+	}
+	if err = walkDir(parent, dir, opts, addEntry); err != nil {
+		return err
+	}
+	if err = tw.Flush(); err != nil {
+		return err
+	}
+	if opts.dirSizeReport != nil {
+		opts.dirSizeReport(a.dirSizes)
+	}
+	return nil
+}
+
+// rootName returns the name of the top-level directory in an archive of dir,
+// which is the name set by WithBaseName, if any, or else dir.
+func (c *config) rootName(dir string) (string, error) {
+	name := c.baseName
+	if name == "" {
+		return dir, nil
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid base name %q", name)
+	}
+	return name, nil
+}
+
+// checkOwner returns an error if the owner set by WithOwner has a negative user
+// or group ID.
+func (c *config) checkOwner() error {
+	if c.owner && (c.uid < 0 || c.gid < 0) {
+		return fmt.Errorf("invalid owner uid %d gid %d", c.uid, c.gid)
+	}
+	return nil
+}
+
+// splitParent returns the parent directory of dir and the base name of dir.
+// The base name is the name of the directory in an archive.
+func splitParent(dir string) (string, string, error) {
+	dir = strings.TrimRight(dir, string(filepath.Separator))
+	if base := filepath.Base(dir); base == "." || base == ".." {
+		// Use absolute path to get the name of the directory.
+		var err error
+		if dir, err = filepath.Abs(dir); err != nil {
+			return "", "", err
+		}
+	}
+	return filepath.Dir(dir), filepath.Base(dir), nil
+}
+
+// archiveEntry is a directory or regular file to write to an archive.
+type archiveEntry struct {
+	// path is the location of the file.
+	path string
+	// name is the slash-separated name of the entry in the archive.
+	name string
+	info os.FileInfo
+}
+
+// walkDir calls fn for the directory dir, within baseDir, and for each
+// subdirectory, regular file, and symbolic link beneath it, in the order they
+// are written to an archive. Entries are named by their paths relative to
+// baseDir, so that the current directory is not changed.
+// Entries are visited depth-first in lexical order, with each directory
+// visited before its contents. Files that match ignore options, and empty
+// directories if skipping them, are skipped. If following symbolic links, then
+// each link is visited as the file or directory that it refers to, instead of
+// as a link.
+func walkDir(baseDir, dir string, opts *config, fn func(archiveEntry) error) error {
+	ignores, err := newIgnoreMatcher(opts)
+	if err != nil {
+		return err
+	}
+	includes, err := newIncludeMatcher(opts)
+	if err != nil {
+		return err
+	}
+	w := &dirWalker{
+		baseDir:    baseDir,
+		opts:       opts,
+		includes:   includes,
+		fn:         fn,
+		ignores:    ignores,
+		rootPrefix: filepath.ToSlash(dir) + "/",
+	}
+	return w.walk(dir, nil)
+}
+
+// dirWalker visits the entries within a directory.
+type dirWalker struct {
+	baseDir    string
+	opts       *config
+	fn         func(archiveEntry) error
+	ignores    *fileMatcher
+	includes   *fileMatcher
+	rootPrefix string
+
+	// Directories not yet visited, because nothing has been found in them,
+	// when skipping empty directories.
+	pending []archiveEntry
+}
+
+// visit calls fn for the entry, after first visiting any pending directories
+// that contain it.
+func (w *dirWalker) visit(e archiveEntry) error {
+	for _, dirEntry := range w.pending {
+		if err := w.fn(dirEntry); err != nil {
 			return err
 		}
-		//nolint:errcheck
-		defer os.Chdir(cwd)
 	}
+	w.pending = w.pending[:0]
+	return w.fn(e)
+}
 
-	var ignoreMap map[string]struct{}
-	if len(ignores) != 0 {
-		ignoreMap = make(map[string]struct{}, len(ignores))
-		for _, ign := range ignores {
-			ignoreMap[ign] = struct{}{}
+// walk visits dir and everything beneath it. If following symbolic links,
+// then ancestors holds the real paths of the directories containing dir, to
+// avoid following links in loops.
+func (w *dirWalker) walk(dir string, ancestors []string) error {
+	dirPath := filepath.Join(w.baseDir, dir)
+	fi, err := os.Stat(dirPath)
+	if err != nil {
+		return err
+	}
+	if w.opts.followSymlinks {
+		realDir, err := filepath.EvalSymlinks(dirPath)
+		if err != nil {
+			return err
+		}
+		if containsString(ancestors, realDir) {
+			w.opts.warn(fmt.Sprintf("skipping %s: link to directory that contains it", dir))
+			return nil
 		}
+		ancestors = append(ancestors[:len(ancestors):len(ancestors)], realDir)
+	}
+	slashDir := filepath.ToSlash(dir)
+	dirEntry := archiveEntry{
+		path: dirPath,
+		name: slashDir + "/",
+		info: fi,
+	}
+	if w.opts.skipEmptyDirs && dirEntry.name != w.rootPrefix {
+		// Visit directory when something is found in it. The top-level
+		// directory is always visited.
+		w.pending = append(w.pending, dirEntry)
+		defer func() {
+			if len(w.pending) != 0 && w.pending[len(w.pending)-1].path == dirPath {
+				w.pending = w.pending[:len(w.pending)-1]
+			}
+		}()
+	} else if err = w.visit(dirEntry); err != nil {
+		return err
+	}
+
+	// Visit all the files in the directory, in lexical order.
+	dirEnts, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
 	}
+	for _, de := range dirEnts {
+		fname := de.Name()
+		rel := strings.TrimPrefix(path.Join(slashDir, fname), w.rootPrefix)
+		if w.ignores != nil && w.ignores.match(rel) {
+			continue
+		}
 
-	dirs := []string{dir}
-	for len(dirs) != 0 {
-		// Pop dir from directories stack
-		dir := dirs[len(dirs)-1]
-		dirs = dirs[:len(dirs)-1]
-		if dir == "" {
+		relName := filepath.Join(dir, fname)
+		pathName := filepath.Join(dirPath, fname)
+		if de.IsDir() {
+			if err = w.walk(relName, ancestors); err != nil {
+				return err
+			}
 			continue
 		}
 
-		// Add dir header to tar.
-		fi, err := os.Stat(dir)
+		fi, err := de.Info()
 		if err != nil {
 			return err
 		}
-		hdr, err := tar.FileInfoHeader(fi, fi.Name())
+		if fi.Mode()&os.ModeSymlink != 0 && w.opts.followSymlinks {
+			// Use what the link refers to. A link that cannot be followed
+			// is stored as a link.
+			if target, err := os.Stat(pathName); err == nil {
+				if target.IsDir() {
+					if err = w.walk(relName, ancestors); err != nil {
+						return err
+					}
+					continue
+				}
+				fi = target
+			}
+		}
+
+		// Skip files that are not regular files or links.
+		if !fi.Mode().IsRegular() && fi.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if w.includes != nil && !w.includes.match(rel) {
+			continue
+		}
+		err = w.visit(archiveEntry{
+			path: pathName,
+			name: path.Join(slashDir, fname),
+			info: fi,
+		})
 		if err != nil {
 			return err
 		}
-		slashDir := filepath.ToSlash(dir)
-		hdr.Name = slashDir + "/"
-		if err = tw.WriteHeader(hdr); err != nil {
+	}
+	return nil
+}
+
+// containsString returns true if s is in list.
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// archiver writes directory and file entries to a tar writer.
+type archiver struct {
+	tw   *tar.Writer
+	opts *config
+	root string
+	// File system that entries are read from, or nil to read from disk.
+	fsys fs.FS
+
+	// Archive name of first file having each content hash.
+	dedup map[[sha256.Size]byte]string
+	// Archive name of first file archived for each file with hard links.
+	hardLinks map[fileID]string
+	// Total size of files under each immediate subdirectory of root.
+	dirSizes map[string]int64
+	// Limits rate at which file data is read.
+	limiter *rateLimiter
+}
+
+func newArchiver(tw *tar.Writer, opts *config, root string) *archiver {
+	a := &archiver{
+		tw:   tw,
+		opts: opts,
+		root: filepath.ToSlash(root) + "/",
+
+		hardLinks: map[fileID]string{},
+	}
+	if opts.dedup {
+		a.dedup = map[[sha256.Size]byte]string{}
+	}
+	if opts.dirSizeReport != nil {
+		a.dirSizes = map[string]int64{}
+	}
+	if opts.rateLimit > 0 {
+		a.limiter = newRateLimiter(opts.rateLimit)
+	}
+	return a
+}
+
+// addEntry writes the header for the entry, and the file data if the entry is
+// a regular file, to the tar writer.
+func (a *archiver) addEntry(e archiveEntry) error {
+	if err := a.opts.ctxErr(); err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(e.info, e.info.Name())
+	if err != nil {
+		return err
+	}
+	var ok bool
+	if hdr.Name, ok, err = a.transformName(e.name); err != nil {
+		return err
+	}
+	if !ok {
+		if a.opts.progress != nil && e.info.Mode().IsRegular() {
+			// Count the file as done, since it is counted in the total.
+			a.opts.progress.startFile(e.name)
+			a.opts.progress.finishFile(e.info.Size())
+		}
+		return nil
+	}
+
+	if e.info.IsDir() {
+		// Some platforms report a non-zero size for directories, which strict
+		// tar parsers do not accept for directory entries.
+		hdr.Typeflag = tar.TypeDir
+		hdr.Size = 0
+		if a.dirSizes != nil {
+			// Record immediate subdirectories of root.
+			rel, ok := strings.CutPrefix(e.name, a.root)
+			if ok && rel != "" && strings.Count(rel, "/") == 1 {
+				a.dirSizes[strings.TrimSuffix(rel, "/")] = 0
+			}
+		}
+		if a.opts.omitDirEntries {
+			return nil
+		}
+		return a.writeHeader(hdr, e.path)
+	}
+
+	if e.info.Mode()&os.ModeSymlink != 0 {
+		if hdr.Linkname, err = a.readLink(e.path); err != nil {
 			return err
 		}
+		return a.writeHeader(hdr, e.path)
+	}
+
+	if a.opts.progress != nil {
+		a.opts.progress.startFile(e.name)
+	}
+	err = a.addFile(hdr, e)
+	if err == nil && a.opts.progress != nil {
+		// Count all of file as done, including data that was not copied.
+		a.opts.progress.finishFile(e.info.Size())
+	}
+	return err
+}
+
+// transformName returns the name to archive an entry as, and false if the
+// entry is left out of the archive, as determined by any name transform. An
+// error is returned if the transformed name is not a valid entry name.
+func (a *archiver) transformName(name string) (string, bool, error) {
+	if a.opts.nameTransform == nil {
+		return name, true, nil
+	}
+	newName, ok := a.opts.nameTransform(name)
+	if !ok {
+		return "", false, nil
+	}
+	clean, err := cleanEntryName(newName)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot archive %s: %w", name, err)
+	}
+	if strings.HasSuffix(name, "/") {
+		clean += "/"
+	}
+	return clean, true, nil
+}
 
-		// Add all the files in the directory to the archive.
-		dirEnts, err := os.ReadDir(dir)
+// open opens the file at path p, in the file system of the archiver if it has
+// one.
+func (a *archiver) open(p string) (fs.File, error) {
+	if a.fsys != nil {
+		return a.fsys.Open(p)
+	}
+	return os.Open(p)
+}
+
+// readLink returns the target of the symbolic link at path p, in the file
+// system of the archiver if it has one.
+func (a *archiver) readLink(p string) (string, error) {
+	if a.fsys != nil {
+		return readLinkFS(a.fsys, p)
+	}
+	return os.Readlink(p)
+}
+
+// addFile writes the header and data of a regular file to the tar writer.
+func (a *archiver) addFile(hdr *tar.Header, e archiveEntry) error {
+	// Skip files that have not changed since the delta base.
+	if base := a.opts.deltaBase; base != nil {
+		if base.unchanged(hdr) {
+			return nil
+		}
+		base.setModTimeDelta(hdr)
+	}
+
+	// Read the start of the file to check if its content type is skipped, or
+	// to detect its content type. The bytes read are written to the archive
+	// ahead of the rest of the file, so that the file is not read again.
+	var f fs.File
+	var head []byte
+	if a.opts.skipContentType != nil || a.opts.detectContentType {
+		var err error
+		f, err = a.open(e.path)
 		if err != nil {
 			return err
 		}
-		for _, de := range dirEnts {
-			fname := de.Name()
-			if _, found := ignoreMap[fname]; found {
-				continue
+		defer f.Close()
+		head = make([]byte, tarBlockSize)
+		n, err := io.ReadFull(f, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		head = head[:n]
+		if a.opts.skipContentType != nil && a.opts.skipContentType(e.name, head) {
+			return nil
+		}
+		if a.opts.detectContentType {
+			if hdr.PAXRecords == nil {
+				hdr.PAXRecords = map[string]string{}
 			}
+			hdr.PAXRecords[paxContentType] = http.DetectContentType(head)
+		}
+	}
 
-			pathName := filepath.Join(dir, fname)
+	// If file is a hard link to a file already archived, then write a link
+	// to that file instead of storing the content again.
+	id, isLinked := hardLinkID(e.info)
+	if isLinked {
+		if first, found := a.hardLinks[id]; found {
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = first
+			hdr.Size = 0
+			return a.writeHeader(hdr, e.path)
+		}
+	}
 
-			// If subdir, push onto stack to handle next iteration.
-			if de.IsDir() {
-				dirs = append(dirs, pathName)
-				continue
-			}
+	if a.opts.throttle != nil {
+		a.opts.throttle()
+	}
 
-			// Skip non-regular files.
-			if !de.Type().IsRegular() {
-				continue
+	if a.opts.capabilities && a.fsys == nil {
+		capData, err := getCapability(e.path)
+		if err != nil {
+			return err
+		}
+		if capData != nil {
+			if hdr.PAXRecords == nil {
+				hdr.PAXRecords = map[string]string{}
 			}
+			hdr.PAXRecords[paxCapability] = string(capData)
+		}
+	}
 
-			fi, err := de.Info()
-			if err != nil {
-				return err
-			}
+	var sum [sha256.Size]byte
+	if a.dedup != nil || a.opts.checksums {
+		fh, err := a.open(e.path)
+		if err != nil {
+			return err
+		}
+		sum, err = hashReader(fh)
+		fh.Close()
+		if err != nil {
+			return err
+		}
+	}
 
-			// Create a new file header and write it to tar writer.
-			if hdr, err = tar.FileInfoHeader(fi, fname); err != nil {
-				return err
-			}
-			hdr.Name = path.Join(slashDir, fname)
-			if err = tw.WriteHeader(hdr); err != nil {
-				return err
-			}
+	// If file has same content as a file already archived, then write a link
+	// to that file instead of storing the content again.
+	if a.dedup != nil {
+		if first, found := a.dedup[sum]; found {
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = first
+			hdr.Size = 0
+			return a.writeHeader(hdr, e.path)
+		}
+		a.dedup[sum] = hdr.Name
+	}
+	if isLinked {
+		a.hardLinks[id] = hdr.Name
+	}
 
-			// Copy file data into tar writer.
-			f, err := os.Open(pathName)
-			if err != nil {
-				return err
-			}
-			if _, err = io.Copy(tw, f); err != nil {
-				f.Close()
-				return err
-			}
-			f.Close()
+	if a.opts.checksums {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = map[string]string{}
 		}
+		hdr.PAXRecords[paxSHA256] = hex.EncodeToString(sum[:])
+	}
+
+	if err := a.writeHeader(hdr, e.path); err != nil {
+		return err
+	}
+	if a.opts.dryRun != nil {
+		return nil
+	}
+
+	// Copy file data into tar writer.
+	if f == nil {
+		var err error
+		f, err = a.open(e.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	var src io.Reader = f
+	if len(head) != 0 {
+		src = io.MultiReader(bytes.NewReader(head), f)
+	}
+	if a.limiter != nil {
+		src = &rateLimitedReader{r: src, limiter: a.limiter}
+	}
+	if a.opts.progress != nil {
+		src = &progressReader{r: src, progress: a.opts.progress}
+	}
+	if _, err := copyContext(a.opts.ctx, a.tw, src); err != nil {
+		return err
+	}
+
+	if a.dirSizes != nil {
+		rel, _ := strings.CutPrefix(e.name, a.root)
+		if top, _, found := strings.Cut(rel, "/"); found {
+			a.dirSizes[top] += hdr.Size
+		}
+	}
+	return nil
+}
+
+// hashFile returns the SHA-256 hash of the file's content.
+func hashFile(name string) ([sha256.Size]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+// hashReader returns the SHA-256 hash of the data read from r.
+func hashReader(r io.Reader) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// writeHeader writes the header, for the file at filePath, to the tar writer.
+// The header is first made deterministic if required, any directory template,
+// root mode, and owner are set, and any header mutator is called. Then the
+// header name is normalized to use forward slashes as path separators, as the
+// tar format requires.
+func (a *archiver) writeHeader(hdr *tar.Header, filePath string) error {
+	if a.opts.deterministic {
+		normalizeHeader(hdr)
+	}
+	if hdr.Typeflag == tar.TypeDir && a.opts.dirTemplate != nil {
+		hdr.Mode = int64(a.opts.dirTemplate.mode.Perm())
+		hdr.Uid = a.opts.dirTemplate.uid
+		hdr.Gid = a.opts.dirTemplate.gid
+		hdr.Uname = ""
+		hdr.Gname = ""
+	}
+	if hdr.Typeflag == tar.TypeDir && hdr.Name == a.root && a.opts.rootMode != 0 {
+		hdr.Mode = int64(a.opts.rootMode.Perm())
+	}
+	if a.opts.owner {
+		hdr.Uid = a.opts.uid
+		hdr.Gid = a.opts.gid
+		hdr.Uname = a.opts.uname
+		hdr.Gname = a.opts.gname
+	}
+	if a.opts.headerMutator != nil {
+		a.opts.headerMutator(hdr, filePath)
+	}
+	hdr.Name = filepath.ToSlash(hdr.Name)
+	if a.opts.stats != nil {
+		a.opts.stats.add(hdr)
+	}
+	if a.opts.dryRun != nil {
+		a.opts.dryRun(hdr)
+		return nil
+	}
+	return a.tw.WriteHeader(hdr)
+}
+
+// deterministicTime is the modification time of every entry in a
+// deterministic archive.
+var deterministicTime = time.Unix(0, 0)
+
+// normalizeHeader removes the information from a header that differs between
+// archives of identical content, such as times and ownership. Permissions are
+// normalized to 0755 for directories and executable files, and 0644 for other
+// files.
+func normalizeHeader(hdr *tar.Header) {
+	hdr.ModTime = deterministicTime
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	hdr.Uid = 0
+	hdr.Gid = 0
+	hdr.Uname = ""
+	hdr.Gname = ""
+	hdr.Devmajor = 0
+	hdr.Devminor = 0
+	switch {
+	case hdr.Typeflag == tar.TypeDir, hdr.Mode&0111 != 0:
+		hdr.Mode = 0755
+	default:
+		hdr.Mode = 0644
 	}
-	return tw.Flush()
 }
 
 // Extract reads gzipped tar data from file into a directory.
-func Extract(tarPath, targetDir string) error {
+func Extract(tarPath, targetDir string, options ...Option) error {
 	f, err := os.Open(tarPath)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	return ExtractReader(f, targetDir)
+	return ExtractReader(f, targetDir, options...)
+}
+
+// ExtractAuto extracts the archive file at path into the target directory. The
+// archive may be an uncompressed tar file or a gzip, zstd, or bzip2 compressed
+// tar file. The format is detected from the archive data. If the file name
+// extension, such as ".tar", ".tar.gz", or ".tgz", indicates a different
+// format than the data, then a warning is issued.
+func ExtractAuto(path, targetDir string, options ...Option) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	opts := getOpts(options)
+	rc, err := decompressFormat(countCompressed(f, &opts), formatFromName(path), &opts)
+	if err != nil {
+		if errors.Is(err, ErrEmptyArchive) && opts.allowEmpty {
+			return nil
+		}
+		return err
+	}
+	defer rc.Close()
+	return extractTar(rc, targetDir, &opts)
 }
 
 // ExtractReader reads gzipped tar data from io.Reader and extracts it into the
-// target directory.
-func ExtractReader(r io.Reader, targetDir string) error {
-	// gzip reader reads from archive file.
-	gzr, err := gzip.NewReader(r)
+// target directory. The compression format is detected from the data, so
+// uncompressed tar data and zstd or bzip2 compressed tar data are also
+// extracted. If the data ends before the end of the archive, then an
+// error wrapping ErrTruncatedArchive is returned, which reports the number of
+// entries extracted. If there is no data, then ErrEmptyArchive is returned,
+// unless WithAllowEmpty is enabled.
+//
+// An entry that would be written outside of the target directory, either by
+// its name or by following symbolic links already in the target directory,
+// is not extracted, and an error wrapping ErrOutsideTarget is returned.
+func ExtractReader(r io.Reader, targetDir string, options ...Option) error {
+	opts := getOpts(options)
+
+	// Decompressing reader reads from archive file.
+	gzr, err := decompressReader(countCompressed(r, &opts), &opts)
 	if err != nil {
+		if errors.Is(err, ErrEmptyArchive) && opts.allowEmpty {
+			return nil
+		}
 		return err
 	}
 	defer gzr.Close()
 
-	if targetDir == "" {
-		targetDir = "."
-	}
+	return extractTar(gzr, targetDir, &opts)
+}
 
-	uid := -1
-	gid := -1
-	isRoot := os.Getuid() == 0
+// extractTar reads uncompressed tar data from r and extracts it into the
+// target directory.
+func extractTar(r io.Reader, targetDir string, opts *config) error {
+	x := newExtractor(targetDir, opts)
+	if opts.cleanTarget {
+		if err := cleanDir(x.targetDir); err != nil {
+			return err
+		}
+	}
 
-	// tar reader reads from gzip.
-	tr := tar.NewReader(gzr)
+	// tar reader reads from decompressed data.
+	tr := tar.NewReader(r)
 	for {
 		header, err := tr.Next()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
+			return x.readError(err)
+		}
+		if err = opts.ctxErr(); err != nil {
 			return err
 		}
-		if header == nil {
+		// Skip entries that do not describe files, such as global headers.
+		if header == nil || header.Typeflag == tar.TypeXGlobalHeader {
 			continue
 		}
-
-		if isRoot {
-			uid = -1
-			if header.Uname != "" {
-				usr, err := user.Lookup(header.Uname)
-				// Ignore error; user not on this host.
-				if err == nil {
-					uid, err = strconv.Atoi(usr.Uid)
-					if err != nil {
-						return err
-					}
-				}
-			}
-			gid = -1
-			if header.Gname != "" {
-				grp, err := user.LookupGroup(header.Gname)
-				// Ignore error; group not on this host.
-				if err == nil {
-					gid, err = strconv.Atoi(grp.Gid)
-					if err != nil {
-						return err
-					}
-				}
-			}
+		if !opts.selectEntry(header) {
+			continue
 		}
-
-		target := filepath.Join(targetDir, header.Name)
-		fi := header.FileInfo()
-		mode := fi.Mode()
-
-		if mode.IsDir() {
-			if _, err = os.Stat(target); err != nil {
-				if err = os.MkdirAll(target, mode.Perm()); err != nil {
-					return err
-				}
-				if uid != -1 || gid != -1 {
-					// Ignore error; may not be allowed on NAS.
-					_ = os.Chown(target, uid, gid)
-				}
-			}
-		} else if mode.IsRegular() {
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode.Perm())
-			if err != nil {
-				return err
-			}
-
-			if _, err = io.Copy(f, tr); err != nil {
-				f.Close()
-				return err
-			}
-			f.Close()
-
-			if uid != -1 || gid != -1 {
-				// Ignore error; may not be allowed on NAS.
-				_ = os.Chown(target, uid, gid)
-			}
+		if opts.dirCompleteHook != nil {
+			x.trackDirs(header)
+		}
+		if err = x.extractEntry(header, tr); err != nil {
+			return x.readError(err)
 		}
 	}
+	if err := x.finish(); err != nil {
+		return err
+	}
+	if opts.dirCompleteHook != nil {
+		x.finishDirs()
+	}
+	if opts.quarantineReport != nil {
+		opts.quarantineReport(x.quarantined)
+	}
+	if opts.stats != nil && opts.compressed != nil {
+		opts.stats.CompressedBytes = opts.compressed.n
+	}
 
 	return nil
 }
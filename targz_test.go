@@ -2,12 +2,22 @@ package targz_test
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gammazero/targz"
 	"github.com/stretchr/testify/require"
@@ -198,3 +208,995 @@ func TestIgnore(t *testing.T) {
 	require.ErrorIs(t, err, io.EOF)
 	require.Equal(t, len(files), i, "archive has wrong number of files")
 }
+
+func TestCreateReaderBounded(t *testing.T) {
+	const (
+		srcName  = "src"
+		fileName = "big.dat"
+		bufSize  = 64 * 1024
+		dataSize = 16 * 1024 * 1024
+	)
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, srcName)
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+
+	// Random data does not compress, so the archive is as large as the data.
+	data := make([]byte, dataSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, fileName), data, 0640))
+	wantSum := sha256.Sum256(data)
+	data = nil
+
+	var before, during runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	rc := targz.CreateReader(srcDir, targz.WithPipeBufferSize(bufSize))
+	defer rc.Close()
+	slow := &slowReader{r: rc}
+
+	gzr, err := gzip.NewReader(slow)
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, srcName+"/", hdr.Name)
+
+	hdr, err = tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, path.Join(srcName, fileName), hdr.Name)
+
+	// Read part of the file, then stall to give the archiving goroutine time
+	// to run ahead if it is not bounded.
+	h := sha256.New()
+	_, err = io.CopyN(h, tr, dataSize/4)
+	require.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+	runtime.GC()
+	runtime.ReadMemStats(&during)
+	require.Less(t, int64(during.HeapAlloc)-int64(before.HeapAlloc), int64(dataSize/4),
+		"archive data buffered without bound")
+
+	_, err = io.Copy(h, tr)
+	require.NoError(t, err)
+	require.Equal(t, wantSum[:], h.Sum(nil))
+
+	_, err = tr.Next()
+	require.ErrorIs(t, err, io.EOF)
+	require.NoError(t, gzr.Close())
+}
+
+func TestCreateReaderError(t *testing.T) {
+	rc := targz.CreateReader(filepath.Join(t.TempDir(), "missing"))
+	defer rc.Close()
+	_, err := io.Copy(io.Discard, rc)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// slowReader reads in small pieces with a delay between each read.
+type slowReader struct {
+	r io.Reader
+	n int
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	if len(p) > 4096 {
+		p = p[:4096]
+	}
+	s.n++
+	if s.n%256 == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	return s.r.Read(p)
+}
+
+func TestForwardSlashNames(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("path separator is already forward slash")
+	}
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	subDir := filepath.Join(srcDir, "sub")
+	require.NoError(t, os.MkdirAll(subDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(subDir, "a.txt"), []byte("a"), 0640))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	archive := buf.Bytes()
+
+	gzr, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var names []string
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		require.NotContains(t, hdr.Name, `\`)
+		names = append(names, hdr.Name)
+	}
+	require.Equal(t, []string{"src/", "src/sub/", "src/sub/a.txt"}, names)
+
+	// Extract and check that names are converted to OS paths.
+	require.NoError(t, os.RemoveAll(srcDir))
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), tmpDir))
+	_, err = os.Stat(filepath.Join(subDir, "a.txt"))
+	require.NoError(t, err)
+}
+
+func TestHeaderNameSeparators(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), []byte("a"), 0640))
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+
+	// Names set using OS path separators are written with forward slashes.
+	mutator := func(hdr *tar.Header, _ string) {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Name = filepath.Join("src", "sub", "renamed.txt")
+		}
+	}
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithHeaderMutator(mutator)))
+	require.Equal(t, []string{"src/", "src/sub/", "src/sub/renamed.txt"}, archiveNames(t, tarPath))
+
+	transform := func(name string) (string, bool) {
+		return filepath.Join("top", filepath.FromSlash(name)), true
+	}
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithNameTransform(transform)))
+	require.Equal(t, []string{"top/src/", "top/src/sub/", "top/src/sub/a.txt"}, archiveNames(t, tarPath))
+}
+
+func TestFileOpener(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	subDir := filepath.Join(srcDir, "sub")
+	require.NoError(t, os.MkdirAll(subDir, 0750))
+	contents := map[string]string{
+		filepath.Join("src", "a.txt"):        "hello",
+		filepath.Join("src", "sub", "b.txt"): "world",
+	}
+	for name, data := range contents {
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(data), 0640))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+
+	outDir := t.TempDir()
+	written := map[string]*bytes.Buffer{}
+	opener := func(name string, mode os.FileMode) (io.WriteCloser, error) {
+		require.Equal(t, os.FileMode(0640), mode)
+		b := &bytes.Buffer{}
+		written[name] = b
+		return nopWriteCloser{b}, nil
+	}
+	require.NoError(t, targz.ExtractReader(&buf, outDir, targz.WithFileOpener(opener)))
+
+	require.Len(t, written, len(contents))
+	for name, data := range contents {
+		target := filepath.Join(outDir, name)
+		require.Contains(t, written, target)
+		require.Equal(t, data, written[target].String())
+		// File was not written by os.
+		_, err := os.Stat(target)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+	// Directories are still created.
+	fi, err := os.Stat(filepath.Join(outDir, "src", "sub"))
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestDirSizeReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	files := map[string]int{
+		"top.txt":         7,
+		"a/one.txt":       10,
+		"a/two.txt":       20,
+		"a/deep/three":    30,
+		"b/four.txt":      5,
+		"b/deeper/x/five": 1,
+	}
+	for name, size := range files {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, make([]byte, size), 0640))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(srcDir, "empty"), 0750))
+
+	var sizes map[string]int64
+	err := targz.CreateWriter(srcDir, io.Discard, targz.WithDirSizeReport(func(m map[string]int64) {
+		sizes = m
+	}))
+	require.NoError(t, err)
+
+	expect := map[string]int64{
+		"a":     60,
+		"b":     6,
+		"empty": 0,
+	}
+	require.Equal(t, expect, sizes)
+}
+
+func TestDedup(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+
+	dupData := make([]byte, 4096)
+	rand.New(rand.NewSource(2)).Read(dupData)
+	dups := []string{"a.bin", "b.bin", "sub/c.bin"}
+	for _, name := range dups {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, filepath.FromSlash(name)), dupData, 0640))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "other.txt"), []byte("other"), 0640))
+
+	var plain, deduped bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &plain))
+	require.NoError(t, targz.CreateWriter(srcDir, &deduped, targz.WithDedup(true)))
+	require.Less(t, deduped.Len(), plain.Len())
+
+	gzr, err := gzip.NewReader(bytes.NewReader(deduped.Bytes()))
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var stored, links int
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			if hdr.Size == int64(len(dupData)) {
+				stored++
+			}
+		case tar.TypeLink:
+			require.Equal(t, "src/a.bin", hdr.Linkname)
+			links++
+		}
+	}
+	require.Equal(t, 1, stored, "duplicate content stored more than once")
+	require.Equal(t, len(dups)-1, links)
+
+	// Extract with hard links.
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(deduped.Bytes()), outDir))
+	first, err := os.Stat(filepath.Join(outDir, "src", "a.bin"))
+	require.NoError(t, err)
+	for _, name := range dups {
+		p := filepath.Join(outDir, "src", filepath.FromSlash(name))
+		got, err := os.ReadFile(p)
+		require.NoError(t, err)
+		require.Equal(t, dupData, got)
+		fi, err := os.Stat(p)
+		require.NoError(t, err)
+		require.True(t, os.SameFile(first, fi))
+	}
+
+	// Extract with copies.
+	outDir = t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(deduped.Bytes()), outDir, targz.WithCopyLinks(true)))
+	first, err = os.Stat(filepath.Join(outDir, "src", "a.bin"))
+	require.NoError(t, err)
+	for _, name := range dups[1:] {
+		p := filepath.Join(outDir, "src", filepath.FromSlash(name))
+		got, err := os.ReadFile(p)
+		require.NoError(t, err)
+		require.Equal(t, dupData, got)
+		fi, err := os.Stat(p)
+		require.NoError(t, err)
+		require.False(t, os.SameFile(first, fi))
+	}
+}
+
+func TestBaseDir(t *testing.T) {
+	baseDir := t.TempDir()
+	srcDir := filepath.Join(baseDir, "proj", "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("b"), 0640))
+
+	// Relative source directory does not exist in current directory.
+	relDir := filepath.Join("proj", "src")
+	_, err := os.Stat(relDir)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	tarPath := filepath.Join(t.TempDir(), "test.tar.gz")
+	require.NoError(t, targz.Create(relDir, tarPath, targz.WithBaseDir(baseDir)))
+
+	f, err := os.Open(tarPath)
+	require.NoError(t, err)
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var names []string
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	require.Equal(t, []string{"src/", "src/a.txt", "src/sub/", "src/sub/b.txt"}, names)
+
+	// Absolute path is not affected by base directory.
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithBaseDir(t.TempDir())))
+
+	// Base directory itself cannot be the current directory.
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	err = targz.Create(".", tarPath, targz.WithBaseDir(cwd))
+	require.ErrorContains(t, err, "cannot archive current directory")
+}
+
+func TestOmitDirEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	files := []string{"a.txt", "sub/b.txt", "sub/deep/c.txt"}
+	for _, name := range files {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithOmitDirEntries(true)))
+	require.Equal(t, []string{"src/a.txt", "src/sub/b.txt", "src/sub/deep/c.txt"}, archiveNames(t, tarPath))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(outDir, "src", filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.Equal(t, name, string(data))
+	}
+}
+
+func TestHeaderMutator(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+
+	var paths []string
+	mutator := func(hdr *tar.Header, filePath string) {
+		paths = append(paths, filepath.ToSlash(filePath))
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = map[string]string{}
+		}
+		hdr.PAXRecords["EXAMPLE.origin"] = "test:" + hdr.Name
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithHeaderMutator(mutator)))
+	require.Equal(t, []string{filepath.ToSlash(srcDir), filepath.ToSlash(filepath.Join(srcDir, "a.txt"))}, paths)
+
+	gzr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var count int
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		require.Equal(t, "test:"+hdr.Name, hdr.PAXRecords["EXAMPLE.origin"])
+		count++
+	}
+	require.Equal(t, 2, count)
+}
+
+func TestCreateCurrentDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	workDir := filepath.Join(tmpDir, "work")
+	require.NoError(t, os.Mkdir(workDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "a.txt"), []byte("a"), 0640))
+	link := filepath.Join(tmpDir, "link")
+	require.NoError(t, os.Symlink(workDir, link))
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(workDir))
+	defer func() {
+		require.NoError(t, os.Chdir(cwd))
+	}()
+
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	for _, dir := range []string{".", "", workDir, link, "../work", link + "/"} {
+		err = targz.Create(dir, tarPath)
+		require.ErrorContains(t, err, "cannot archive current directory", "dir %q", dir)
+	}
+
+	// Archiving current directory is allowed with option.
+	require.NoError(t, targz.Create(".", tarPath, targz.WithAllowCurrentDir(true)))
+	require.Equal(t, []string{"work/", "work/a.txt"}, archiveNames(t, tarPath))
+}
+
+func TestSkipContentType(t *testing.T) {
+	pngSig := []byte("\x89PNG\r\n\x1a\n")
+	big := append(append([]byte{}, bytes.Repeat([]byte("x"), 600)...), "end"...)
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "image.dat"), append(pngSig, "image"...), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "pic.txt"), pngSig, 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "big.txt"), big, 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "empty.txt"), nil, 0640))
+
+	var names []string
+	skipPNG := func(name string, header []byte) bool {
+		names = append(names, name)
+		return bytes.HasPrefix(header, pngSig)
+	}
+
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithSkipContentType(skipPNG)))
+	require.ElementsMatch(t, []string{"src/image.dat", "src/sub/pic.txt", "src/big.txt", "src/empty.txt"}, names)
+	require.Equal(t, []string{"src/", "src/big.txt", "src/empty.txt", "src/sub/"}, archiveNames(t, tarPath))
+
+	// Content read to check type is still archived.
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "big.txt"))
+	require.NoError(t, err)
+	require.Equal(t, big, data)
+}
+
+func TestOwnerNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), []byte("a"), 0640))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithOwnerNames("root", "wheel")))
+
+	gzr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var count int
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		require.Equal(t, "root", hdr.Uname, hdr.Name)
+		require.Equal(t, "wheel", hdr.Gname, hdr.Name)
+		require.Zero(t, hdr.Uid)
+		require.Zero(t, hdr.Gid)
+		count++
+	}
+	require.Equal(t, 3, count)
+}
+
+func TestOwner(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), []byte("a"), 0640))
+
+	for _, owner := range []struct {
+		uid, gid     int
+		uname, gname string
+	}{
+		{0, 0, "root", "root"},
+		{1234, 5678, "", ""},
+	} {
+		var buf bytes.Buffer
+		err := targz.CreateWriter(srcDir, &buf, targz.WithOwner(owner.uid, owner.gid, owner.uname, owner.gname))
+		require.NoError(t, err)
+
+		gzr, err := gzip.NewReader(&buf)
+		require.NoError(t, err)
+		tr := tar.NewReader(gzr)
+		var count int
+		for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+			require.NoError(t, err)
+			require.Equal(t, owner.uid, hdr.Uid, hdr.Name)
+			require.Equal(t, owner.gid, hdr.Gid, hdr.Name)
+			require.Equal(t, owner.uname, hdr.Uname, hdr.Name)
+			require.Equal(t, owner.gname, hdr.Gname, hdr.Name)
+			count++
+		}
+		require.Equal(t, 3, count)
+	}
+
+	err := targz.CreateWriter(srcDir, io.Discard, targz.WithOwner(-1, 0, "", ""))
+	require.ErrorContains(t, err, "invalid owner")
+	err = targz.CreateWriter(srcDir, io.Discard, targz.WithOwner(0, -1, "", ""))
+	require.ErrorContains(t, err, "invalid owner")
+	_, err = targz.CreateDryRun(srcDir, targz.WithOwner(-1, 0, "", ""))
+	require.ErrorContains(t, err, "invalid owner")
+}
+
+func TestDirHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub", "deep"), 0750))
+	// Many entries make the directory size non-zero on some platforms.
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(srcDir, "sub", fmt.Sprintf("file-with-a-long-name-%03d.txt", i))
+		require.NoError(t, os.WriteFile(name, []byte("data"), 0640))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	gzr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	raw, err := io.ReadAll(gzr)
+	require.NoError(t, err)
+
+	// Read raw header blocks, skipping data blocks.
+	var dirs []string
+	for len(raw) >= 512 && !bytes.Equal(raw[:512], make([]byte, 512)) {
+		block := raw[:512]
+		raw = raw[512:]
+		name := string(bytes.TrimRight(block[:100], "\x00"))
+		size, err := strconv.ParseInt(strings.TrimSpace(string(bytes.TrimRight(block[124:136], "\x00"))), 8, 64)
+		require.NoError(t, err)
+		if strings.HasSuffix(name, "/") {
+			dirs = append(dirs, name)
+			require.Equal(t, byte(tar.TypeDir), block[156], name)
+			require.Zero(t, size, name)
+		}
+		raw = raw[(size+511)/512*512:]
+	}
+	require.ElementsMatch(t, []string{"src/", "src/sub/", "src/sub/deep/"}, dirs)
+}
+
+func TestDetectContentType(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	files := map[string][]byte{
+		"image.dat": append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 600)...),
+		"page.bin":  []byte("<!DOCTYPE html><html><body>hi</body></html>"),
+		"notes":     []byte("plain text notes\n"),
+		"empty":     nil,
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), data, 0640))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithDetectContentType(true)))
+	archive := buf.Bytes()
+
+	gzr, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	types := map[string]string{}
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			types[path.Base(hdr.Name)] = hdr.PAXRecords["TARGZ.content_type"]
+		}
+	}
+	require.Equal(t, map[string]string{
+		"image.dat": "image/png",
+		"page.bin":  "text/html; charset=utf-8",
+		"notes":     "text/plain; charset=utf-8",
+		"empty":     "text/plain; charset=utf-8",
+	}, types)
+
+	// Content read to detect type is still archived.
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(bytes.NewReader(archive), outDir))
+	for name, data := range files {
+		extracted, err := os.ReadFile(filepath.Join(outDir, "src", name))
+		require.NoError(t, err)
+		require.Equal(t, len(data), len(extracted))
+		require.True(t, bytes.Equal(data, extracted))
+	}
+}
+
+// recordWriter records the size of each write.
+type recordWriter struct {
+	sizes []int
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	w.sizes = append(w.sizes, len(p))
+	return len(p), nil
+}
+
+func TestSyncInterval(t *testing.T) {
+	const interval = 1000
+
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	data := make([]byte, 2000)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		rnd.Read(data)
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, fmt.Sprint(i)), data, 0640))
+	}
+
+	// Without option, data is written when buffer is full.
+	var rw recordWriter
+	require.NoError(t, targz.CreateWriter(srcDir, &rw))
+	for _, size := range rw.sizes[:len(rw.sizes)-1] {
+		require.Equal(t, 4096, size)
+	}
+
+	// With option, data is written after each interval.
+	rw = recordWriter{}
+	require.NoError(t, targz.CreateWriter(srcDir, &rw, targz.WithSyncInterval(interval)))
+	for _, size := range rw.sizes[:len(rw.sizes)-1] {
+		require.GreaterOrEqual(t, size, interval)
+		require.Less(t, size, 2*interval)
+	}
+}
+
+func TestCreateMulti(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"config/app.conf", "data/sub/db.bin", "logs/app.log"} {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+	dirs := []string{
+		filepath.Join(tmpDir, "config"),
+		filepath.Join(tmpDir, "data"),
+		filepath.Join(tmpDir, "logs"),
+	}
+
+	var lastDone, lastTotal int64
+	progress := func(_ string, done, total int64) {
+		lastDone = done
+		lastTotal = total
+	}
+	tarPath := filepath.Join(t.TempDir(), "test.tar.gz")
+	require.NoError(t, targz.CreateMulti(dirs, tarPath, targz.WithProgress(progress)))
+	require.Equal(t, []string{
+		"config/", "config/app.conf",
+		"data/", "data/sub/", "data/sub/db.bin",
+		"logs/", "logs/app.log",
+	}, archiveNames(t, tarPath))
+	require.Equal(t, lastTotal, lastDone)
+	require.Equal(t, int64(len("config/app.conf")+len("data/sub/db.bin")+len("logs/app.log")), lastTotal)
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "data", "sub", "db.bin"))
+	require.NoError(t, err)
+	require.Equal(t, "data/sub/db.bin", string(data))
+
+	// Directories with same base name.
+	otherLogs := filepath.Join(tmpDir, "data", "logs")
+	require.NoError(t, os.Mkdir(otherLogs, 0750))
+	err = targz.CreateMulti(append(dirs, otherLogs), tarPath)
+	require.ErrorContains(t, err, "same name \"logs\"")
+}
+
+func TestIgnorePattern(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	for _, name := range []string{
+		"a.txt", "b.go", "c.tmp",
+		"logs/app.log", "logs/app.txt", "logs/old/x.log",
+		"web/node_modules/pkg/index.js", "web/main.js",
+		"cache/keep.go", "web/cache/data.bin",
+	} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+
+	names := func(options ...targz.Option) []string {
+		tarPath := filepath.Join(tmpDir, "test.tar.gz")
+		require.NoError(t, targz.Create(srcDir, tarPath, options...))
+		var files []string
+		for _, name := range archiveNames(t, tarPath) {
+			if !strings.HasSuffix(name, "/") {
+				files = append(files, strings.TrimPrefix(name, "src/"))
+			}
+		}
+		sort.Strings(files)
+		return files
+	}
+
+	// Base name patterns match at any depth.
+	require.Equal(t, []string{
+		"b.go", "cache/keep.go", "logs/app.log", "logs/old/x.log",
+		"web/cache/data.bin", "web/main.js",
+	}, names(targz.WithIgnorePattern("*.txt", "*.tmp"), targz.WithIgnorePattern("node_modules")))
+
+	// Path patterns match relative to the archived directory.
+	require.Equal(t, []string{
+		"a.txt", "b.go", "c.tmp", "cache/keep.go", "logs/app.txt", "logs/old/x.log",
+		"web/main.js", "web/node_modules/pkg/index.js",
+	}, names(targz.WithIgnorePattern("logs/*.log", "web/cache")))
+
+	// Nested directory glob.
+	require.Equal(t, []string{
+		"a.txt", "b.go", "c.tmp", "logs/app.txt", "web/main.js",
+	}, names(targz.WithIgnorePattern("**/*.log", "**/cache", "web/**/pkg")))
+
+	err := targz.Create(srcDir, filepath.Join(tmpDir, "bad.tar.gz"), targz.WithIgnorePattern("[a-"))
+	require.ErrorContains(t, err, "invalid ignore pattern")
+}
+
+func TestInclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	for _, name := range []string{
+		"main.go", "README.md", "build.sh", "data.bin",
+		"pkg/lib.go", "pkg/lib_test.go", "pkg/notes.txt",
+		"docs/guide.md", "docs/img/logo.png", "vendor/dep/dep.go",
+	} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+
+	names := func(options ...targz.Option) ([]string, []string) {
+		tarPath := filepath.Join(tmpDir, "test.tar.gz")
+		require.NoError(t, targz.Create(srcDir, tarPath, options...))
+		var files, dirs []string
+		for _, name := range archiveNames(t, tarPath) {
+			if strings.HasSuffix(name, "/") {
+				dirs = append(dirs, strings.TrimPrefix(name, "src/"))
+			} else {
+				files = append(files, strings.TrimPrefix(name, "src/"))
+			}
+		}
+		sort.Strings(files)
+		return files, dirs
+	}
+
+	files, dirs := names(targz.WithInclude("*.go", "*.md"))
+	require.Equal(t, []string{
+		"README.md", "docs/guide.md", "main.go", "pkg/lib.go", "pkg/lib_test.go", "vendor/dep/dep.go",
+	}, files)
+	// Directories are still archived.
+	require.Contains(t, dirs, "docs/img/")
+
+	// Ignore takes precedence over include.
+	files, _ = names(targz.WithInclude("*.go", "docs/*"), targz.WithIgnorePattern("*_test.go", "vendor"))
+	require.Equal(t, []string{"docs/guide.md", "main.go", "pkg/lib.go"}, files)
+
+	err := targz.Create(srcDir, filepath.Join(tmpDir, "bad.tar.gz"), targz.WithInclude("[a-"))
+	require.ErrorContains(t, err, "invalid include pattern")
+}
+
+func TestNameTransform(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/skip.log"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+
+	var originals []string
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	err := targz.Create(srcDir, tarPath, targz.WithNameTransform(func(name string) (string, bool) {
+		originals = append(originals, name)
+		if strings.HasSuffix(name, ".log") {
+			return "", false
+		}
+		return strings.ToUpper(strings.TrimSuffix(name, "/")), true
+	}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"src/", "src/a.txt", "src/sub/", "src/sub/b.txt", "src/sub/skip.log"}, originals)
+	require.Equal(t, []string{"SRC/", "SRC/A.TXT", "SRC/SUB/", "SRC/SUB/B.TXT"}, archiveNames(t, tarPath))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "SRC", "SUB", "B.TXT"))
+	require.NoError(t, err)
+	require.Equal(t, "sub/b.txt", string(data))
+	_, err = os.Stat(filepath.Join(outDir, "SRC", "SUB", "SKIP.LOG"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Transformed names are cleaned, and invalid names are rejected.
+	err = targz.Create(srcDir, tarPath, targz.WithNameTransform(func(name string) (string, bool) {
+		return "./out/" + name, true
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "out/src/", archiveNames(t, tarPath)[0])
+	for _, bad := range []string{"", ".", "..", "../escape", "/abs", "a/../../escape"} {
+		err = targz.Create(srcDir, tarPath, targz.WithNameTransform(func(name string) (string, bool) {
+			if name == "src/a.txt" {
+				return bad, true
+			}
+			return name, true
+		}))
+		require.ErrorContains(t, err, "invalid entry name", bad)
+	}
+}
+
+func TestEntryOrder(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	// Create in non-lexical order.
+	for _, name := range []string{"z.txt", "m/z.txt", "m/b/y.txt", "m/a.txt", "b/c/d.txt", "a.txt", "c.txt"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+
+	expect := []string{
+		"src/",
+		"src/a.txt",
+		"src/b/",
+		"src/b/c/",
+		"src/b/c/d.txt",
+		"src/c.txt",
+		"src/m/",
+		"src/m/a.txt",
+		"src/m/b/",
+		"src/m/b/y.txt",
+		"src/m/z.txt",
+		"src/z.txt",
+	}
+	for i := 0; i < 2; i++ {
+		tarPath := filepath.Join(tmpDir, fmt.Sprintf("test%d.tar.gz", i))
+		require.NoError(t, targz.Create(srcDir, tarPath))
+		require.Equal(t, expect, archiveNames(t, tarPath))
+	}
+
+	// Same order from a filesystem.
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateFromFS(os.DirFS(tmpDir), "src", &buf))
+	entries, err := targz.ListReader(&buf)
+	require.NoError(t, err)
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+	require.Equal(t, expect, names)
+}
+
+func TestDeterministic(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/deep/c.bin"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+
+	create := func(name string, options ...targz.Option) []byte {
+		tarPath := filepath.Join(tmpDir, name)
+		require.NoError(t, targz.Create(srcDir, tarPath, options...))
+		data, err := os.ReadFile(tarPath)
+		require.NoError(t, err)
+		return data
+	}
+	touch := func(mt time.Time) {
+		err := filepath.Walk(srcDir, func(p string, _ os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(p, mt, mt)
+		})
+		require.NoError(t, err)
+	}
+
+	touch(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	first := create("first.tar.gz", targz.WithDeterministic(true))
+	plain := create("plain.tar.gz")
+	touch(time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC))
+	second := create("second.tar.gz", targz.WithDeterministic(true))
+	require.True(t, bytes.Equal(first, second), "archives are not identical")
+	require.False(t, bytes.Equal(plain, create("plain2.tar.gz")))
+
+	gzr, err := gzip.NewReader(bytes.NewReader(first))
+	require.NoError(t, err)
+	require.True(t, gzr.ModTime.IsZero())
+	tr := tar.NewReader(gzr)
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		require.Zero(t, hdr.ModTime.Unix(), hdr.Name)
+		require.Zero(t, hdr.Uid, hdr.Name)
+		require.Empty(t, hdr.Uname, hdr.Name)
+		if hdr.Typeflag == tar.TypeDir {
+			require.Equal(t, int64(0755), hdr.Mode, hdr.Name)
+		} else {
+			require.Equal(t, int64(0644), hdr.Mode, hdr.Name)
+		}
+	}
+}
+
+func TestSkipEmptyDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	for _, name := range []string{"a.txt", "sub/b.txt", "ignored/x.tmp", "nested/ignored/y.tmp"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0640))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "empty", "inner"), 0750))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub", "empty"), 0750))
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithIgnorePattern("*.tmp")))
+	require.Equal(t, []string{
+		"src/", "src/a.txt", "src/empty/", "src/empty/inner/", "src/ignored/",
+		"src/nested/", "src/nested/ignored/", "src/sub/", "src/sub/b.txt", "src/sub/empty/",
+	}, archiveNames(t, tarPath))
+
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithIgnorePattern("*.tmp"), targz.WithSkipEmptyDirs(true)))
+	require.Equal(t, []string{"src/", "src/a.txt", "src/sub/", "src/sub/b.txt"}, archiveNames(t, tarPath))
+
+	// Top-level directory is kept when empty.
+	emptyDir := filepath.Join(srcDir, "empty")
+	require.NoError(t, targz.Create(emptyDir, tarPath, targz.WithSkipEmptyDirs(true)))
+	require.Equal(t, []string{"empty/"}, archiveNames(t, tarPath))
+}
+
+func TestCreateConcurrent(t *testing.T) {
+	tmpDir := t.TempDir()
+	names := []string{"one", "two", "three", "four"}
+	for _, name := range names {
+		dir := filepath.Join(tmpDir, name, "sub")
+		require.NoError(t, os.MkdirAll(dir, 0750))
+		for i := 0; i < 20; i++ {
+			fname := filepath.Join(dir, fmt.Sprintf("%s-%d.txt", name, i))
+			require.NoError(t, os.WriteFile(fname, []byte(name), 0640))
+		}
+	}
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	bufs := make([]bytes.Buffer, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			errs[i] = targz.CreateWriter(dir, &bufs[i])
+		}(i, filepath.Join(tmpDir, name))
+	}
+	wg.Wait()
+
+	after, err := os.Getwd()
+	require.NoError(t, err)
+	require.Equal(t, cwd, after)
+
+	for i, name := range names {
+		require.NoError(t, errs[i])
+		entries, err := targz.ListReader(&bufs[i])
+		require.NoError(t, err)
+		require.Len(t, entries, 22)
+		for _, e := range entries {
+			require.True(t, strings.HasPrefix(e.Name, name+"/"), e.Name)
+			if !e.IsDir {
+				require.Contains(t, path.Base(e.Name), name+"-")
+			}
+		}
+	}
+}
+
+func TestBaseName(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "output-2024")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "bin"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "bin", "app"), []byte("app"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "README"), []byte("readme"), 0640))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithBaseName("release")))
+	entries, err := targz.ListReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	require.Equal(t, []string{"release/", "release/README", "release/bin/", "release/bin/app"}, names)
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "release", "bin", "app"))
+	require.NoError(t, err)
+	require.Equal(t, "app", string(data))
+	require.NoDirExists(t, filepath.Join(outDir, "output-2024"))
+
+	for _, name := range []string{"a/b", `a\b`, ".."} {
+		err = targz.CreateWriter(srcDir, &buf, targz.WithBaseName(name))
+		require.ErrorContains(t, err, "invalid base name", name)
+	}
+}
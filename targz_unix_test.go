@@ -0,0 +1,239 @@
+//go:build unix
+
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+// archiveHeaders returns the headers, by name, in the gzip compressed archive.
+func archiveHeaders(t *testing.T, archive []byte) map[string]*tar.Header {
+	gzr, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	headers := map[string]*tar.Header{}
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		headers[hdr.Name] = hdr
+	}
+	return headers
+}
+
+func TestCreateSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("b"), 0640))
+	outsideFile := filepath.Join(tmpDir, "outside.txt")
+	require.NoError(t, os.WriteFile(outsideFile, []byte("outside"), 0640))
+
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(srcDir, "rel-link")))
+	require.NoError(t, os.Symlink(outsideFile, filepath.Join(srcDir, "abs-link")))
+	require.NoError(t, os.Symlink("sub", filepath.Join(srcDir, "dir-link")))
+	require.NoError(t, os.Symlink("missing", filepath.Join(srcDir, "broken-link")))
+	// Link back to ancestor, which is a loop when followed.
+	require.NoError(t, os.Symlink("..", filepath.Join(srcDir, "sub", "loop")))
+
+	// Links are stored as links by default.
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	headers := archiveHeaders(t, buf.Bytes())
+	for name, target := range map[string]string{
+		"src/rel-link":    "a.txt",
+		"src/abs-link":    outsideFile,
+		"src/dir-link":    "sub",
+		"src/broken-link": "missing",
+		"src/sub/loop":    "..",
+	} {
+		hdr, ok := headers[name]
+		require.True(t, ok, "missing %s", name)
+		require.Equal(t, byte(tar.TypeSymlink), hdr.Typeflag, name)
+		require.Equal(t, target, hdr.Linkname, name)
+		require.Zero(t, hdr.Size, name)
+	}
+
+	// Links are followed with option.
+	var warnings []string
+	buf.Reset()
+	err := targz.CreateWriter(srcDir, &buf, targz.WithFollowSymlinks(true), targz.WithWarningHandler(func(msg string) {
+		warnings = append(warnings, msg)
+	}))
+	require.NoError(t, err)
+	// Loop is reached through sub and through dir-link.
+	require.Len(t, warnings, 2)
+	for _, msg := range warnings {
+		require.Contains(t, msg, "loop")
+	}
+
+	headers = archiveHeaders(t, buf.Bytes())
+	for name, typeflag := range map[string]byte{
+		"src/rel-link":       tar.TypeReg,
+		"src/abs-link":       tar.TypeReg,
+		"src/dir-link/":      tar.TypeDir,
+		"src/dir-link/b.txt": tar.TypeReg,
+		"src/broken-link":    tar.TypeSymlink,
+	} {
+		hdr, ok := headers[name]
+		require.True(t, ok, "missing %s", name)
+		require.Equal(t, typeflag, hdr.Typeflag, name)
+	}
+	require.NotContains(t, headers, "src/sub/loop/")
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir))
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "abs-link"))
+	require.NoError(t, err)
+	require.Equal(t, "outside", string(data))
+	data, err = os.ReadFile(filepath.Join(outDir, "src", "dir-link", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "b", string(data))
+}
+
+func TestCreateFilesSymlinks(t *testing.T) {
+	baseDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(baseDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(baseDir, "a.txt"), []byte("a"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(baseDir, "sub", "b.txt"), []byte("b"), 0640))
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(baseDir, "file-link")))
+	require.NoError(t, os.Symlink("sub", filepath.Join(baseDir, "dir-link")))
+	require.NoError(t, os.Symlink("missing", filepath.Join(baseDir, "broken-link")))
+	relPaths := []string{"file-link", "dir-link", "broken-link"}
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateFilesWriter(baseDir, relPaths, &buf))
+	headers := archiveHeaders(t, buf.Bytes())
+	require.Len(t, headers, 3)
+	for name, linkname := range map[string]string{"file-link": "a.txt", "dir-link": "sub", "broken-link": "missing"} {
+		require.Equal(t, byte(tar.TypeSymlink), headers[name].Typeflag, name)
+		require.Equal(t, linkname, headers[name].Linkname)
+	}
+
+	// Links are followed, except for the link that cannot be.
+	buf.Reset()
+	require.NoError(t, targz.CreateFilesWriter(baseDir, relPaths, &buf, targz.WithFollowSymlinks(true)))
+	headers = archiveHeaders(t, buf.Bytes())
+	require.Len(t, headers, 4)
+	require.Equal(t, byte(tar.TypeReg), headers["file-link"].Typeflag)
+	require.Equal(t, byte(tar.TypeDir), headers["dir-link/"].Typeflag)
+	require.Equal(t, byte(tar.TypeReg), headers["dir-link/b.txt"].Typeflag)
+	require.Equal(t, byte(tar.TypeSymlink), headers["broken-link"].Typeflag)
+}
+
+func TestRootMode(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0700))
+	require.NoError(t, os.Chmod(srcDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), []byte("a"), 0600))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	headers := archiveHeaders(t, buf.Bytes())
+	require.Equal(t, int64(0700), headers["src/"].Mode)
+
+	buf.Reset()
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithRootMode(0755)))
+	headers = archiveHeaders(t, buf.Bytes())
+	require.Equal(t, int64(0755), headers["src/"].Mode)
+	require.Equal(t, int64(0700), headers["src/sub/"].Mode)
+	require.Equal(t, int64(0600), headers["src/sub/a.txt"].Mode)
+}
+
+func TestDirTemplate(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	for _, dir := range []string{"a", "b/c", "d"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(srcDir, filepath.FromSlash(dir)), 0700))
+	}
+	require.NoError(t, os.Chmod(filepath.Join(srcDir, "b"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b", "file.txt"), []byte("x"), 0600))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithDirTemplate(0755, 1000, 2000)))
+	headers := archiveHeaders(t, buf.Bytes())
+	var dirs int
+	for name, hdr := range headers {
+		if hdr.Typeflag != tar.TypeDir {
+			require.Equal(t, int64(0600), hdr.Mode, name)
+			require.Equal(t, os.Getuid(), hdr.Uid, name)
+			continue
+		}
+		dirs++
+		require.Equal(t, int64(0755), hdr.Mode, name)
+		require.Equal(t, 1000, hdr.Uid, name)
+		require.Equal(t, 2000, hdr.Gid, name)
+		require.Empty(t, hdr.Uname, name)
+		require.Empty(t, hdr.Gname, name)
+	}
+	require.Equal(t, 5, dirs)
+
+	// Root mode takes precedence for top-level directory.
+	buf.Reset()
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithDirTemplate(0755, 0, 0), targz.WithRootMode(0700)))
+	headers = archiveHeaders(t, buf.Bytes())
+	require.Equal(t, int64(0700), headers["src/"].Mode)
+	require.Equal(t, int64(0755), headers["src/b/"].Mode)
+}
+
+func TestHardLinks(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("shared"), 0640))
+	require.NoError(t, os.Link(filepath.Join(srcDir, "a.txt"), filepath.Join(srcDir, "sub", "b.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "c.txt"), []byte("shared"), 0640))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	headers := archiveHeaders(t, buf.Bytes())
+	require.Equal(t, byte(tar.TypeReg), headers["src/a.txt"].Typeflag)
+	require.Equal(t, byte(tar.TypeLink), headers["src/sub/b.txt"].Typeflag)
+	require.Equal(t, "src/a.txt", headers["src/sub/b.txt"].Linkname)
+	require.Zero(t, headers["src/sub/b.txt"].Size)
+	// Same content without a hard link is stored separately.
+	require.Equal(t, byte(tar.TypeReg), headers["src/c.txt"].Typeflag)
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir))
+	fiA, err := os.Stat(filepath.Join(outDir, "src", "a.txt"))
+	require.NoError(t, err)
+	fiB, err := os.Stat(filepath.Join(outDir, "src", "sub", "b.txt"))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(fiA, fiB))
+	require.Equal(t, uint64(2), uint64(fiA.Sys().(*syscall.Stat_t).Nlink))
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "sub", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "shared", string(data))
+}
+
+func TestModeMask(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "open"), 0700))
+	require.NoError(t, os.Chmod(filepath.Join(srcDir, "open"), 0777))
+	fileName := filepath.Join(srcDir, "open", "shared.txt")
+	require.NoError(t, os.WriteFile(fileName, []byte("shared"), 0600))
+	require.NoError(t, os.Chmod(fileName, 0666))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	headers := archiveHeaders(t, buf.Bytes())
+	require.Equal(t, int64(0666), headers["src/open/shared.txt"].Mode)
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir, targz.WithModeMask(0755)))
+	fi, err := os.Stat(filepath.Join(outDir, "src", "open", "shared.txt"))
+	require.NoError(t, err)
+	require.Zero(t, fi.Mode().Perm()&^0755)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm()&0700)
+	fi, err = os.Stat(filepath.Join(outDir, "src", "open"))
+	require.NoError(t, err)
+	require.Zero(t, fi.Mode().Perm()&^0755)
+}
@@ -0,0 +1,43 @@
+package targz
+
+import (
+	"io"
+	"time"
+)
+
+// rateLimiter limits the rate at which data is read, by delaying reads so
+// that the total number of bytes read does not exceed the rate.
+type rateLimiter struct {
+	bytesPerSec int64
+	start       time.Time
+	total       int64
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{
+		bytesPerSec: bytesPerSec,
+		start:       time.Now(),
+	}
+}
+
+// wait records that n more bytes were read, and sleeps until the total number
+// of bytes read is within the rate limit.
+func (l *rateLimiter) wait(n int) {
+	l.total += int64(n)
+	due := time.Duration(float64(l.total) / float64(l.bytesPerSec) * float64(time.Second))
+	if d := due - time.Since(l.start); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// rateLimitedReader is an io.Reader that reads at a limited rate.
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.limiter.wait(n)
+	return n, err
+}
@@ -0,0 +1,38 @@
+package targz_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	const (
+		fileSize  = 64 * 1024
+		fileCount = 4
+		rate      = 1024 * 1024
+	)
+
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	for _, name := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), make([]byte, fileSize), 0640))
+	}
+
+	var throttled int
+	start := time.Now()
+	err := targz.CreateWriter(srcDir, io.Discard, targz.WithRateLimit(rate), targz.WithThrottle(func() {
+		throttled++
+	}))
+	require.NoError(t, err)
+	elapsed := time.Since(start)
+
+	require.Equal(t, fileCount, throttled)
+	minDuration := time.Duration(float64(fileSize*fileCount) / rate * float64(time.Second))
+	require.GreaterOrEqual(t, elapsed, minDuration)
+}
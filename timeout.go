@@ -0,0 +1,107 @@
+package targz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrEntryTimeout is returned when writing an extracted file takes longer
+// than the time allowed by WithEntryTimeout.
+var ErrEntryTimeout = errors.New("timed out writing entry")
+
+// runBefore runs fn and returns its error, or returns ErrEntryTimeout if fn
+// does not finish before the deadline. If fn times out, it continues to run in
+// the background.
+func runBefore(deadline time.Time, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrEntryTimeout
+	}
+}
+
+// openBefore opens a file using openFile, or returns ErrEntryTimeout if the
+// file is not opened before the deadline. A file that is opened after the
+// deadline is closed.
+func openBefore(deadline time.Time, openFile fileOpenerFunc, name string, perm os.FileMode) (io.WriteCloser, error) {
+	type result struct {
+		f   io.WriteCloser
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		f, err := openFile(name, perm)
+		done <- result{f, err}
+	}()
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.f, res.err
+	case <-timer.C:
+		go func() {
+			if res := <-done; res.err == nil {
+				res.f.Close()
+			}
+		}()
+		return nil, ErrEntryTimeout
+	}
+}
+
+// timeoutWriter is a writer that returns ErrEntryTimeout if a write, or
+// close, does not finish before the deadline.
+type timeoutWriter struct {
+	w        io.WriteCloser
+	deadline time.Time
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	// Write a copy, since p may be reused by the caller if the write times
+	// out and continues in the background.
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	var n int
+	err := runBefore(tw.deadline, func() error {
+		var err error
+		n, err = tw.w.Write(buf)
+		return err
+	})
+	if errors.Is(err, ErrEntryTimeout) {
+		return 0, err
+	}
+	return n, err
+}
+
+func (tw *timeoutWriter) Close() error {
+	return runBefore(tw.deadline, tw.w.Close)
+}
+
+// timeoutError returns err, unless err indicates that writing the entry timed
+// out. In that case, the partly written file is removed, and an error
+// describing the timeout is returned, or nil is returned if entries that time
+// out are skipped.
+func (x *extractor) timeoutError(name, target string, err error) error {
+	if !errors.Is(err, ErrEntryTimeout) {
+		return err
+	}
+	// Removing the file may also hang.
+	_ = runBefore(time.Now().Add(x.opts.entryTimeout), func() error {
+		return os.Remove(target)
+	})
+	err = fmt.Errorf("%w: %s not written within %s", ErrEntryTimeout, name, x.opts.entryTimeout)
+	if x.opts.skipTimedOutEntries {
+		x.opts.warn(err.Error())
+		return nil
+	}
+	return err
+}
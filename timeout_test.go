@@ -0,0 +1,85 @@
+package targz_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+// stallWriter is a file writer whose writes block until released, and then
+// fail.
+type stallWriter struct {
+	*os.File
+	release chan struct{}
+}
+
+func (w *stallWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return 0, errors.New("released")
+}
+
+func TestEntryTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	for _, name := range []string{"a.txt", "stall-open.txt", "stall-write.txt", "z.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte(name), 0640))
+	}
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	release := make(chan struct{})
+	defer close(release)
+	opener := func(name string, mode os.FileMode) (io.WriteCloser, error) {
+		if strings.HasSuffix(name, "stall-open.txt") {
+			<-release
+			return nil, errors.New("released")
+		}
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(name, "stall-write.txt") {
+			return &stallWriter{File: f, release: release}, nil
+		}
+		return f, nil
+	}
+
+	const timeout = 50 * time.Millisecond
+	outDir := t.TempDir()
+	start := time.Now()
+	err := targz.Extract(tarPath, outDir, targz.WithFileOpener(opener), targz.WithEntryTimeout(timeout))
+	require.ErrorIs(t, err, targz.ErrEntryTimeout)
+	require.ErrorContains(t, err, "stall-open.txt")
+	require.Less(t, time.Since(start), 10*time.Second)
+
+	// Continue after each entry that times out.
+	var warnings []string
+	warn := func(msg string) {
+		warnings = append(warnings, msg)
+	}
+	outDir = t.TempDir()
+	start = time.Now()
+	err = targz.Extract(tarPath, outDir, targz.WithFileOpener(opener), targz.WithEntryTimeout(timeout),
+		targz.WithSkipTimedOutEntries(true), targz.WithWarningHandler(warn))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 2*timeout)
+	require.Len(t, warnings, 2)
+	require.Contains(t, warnings[0], "stall-open.txt")
+	require.Contains(t, warnings[1], "stall-write.txt")
+	require.FileExists(t, filepath.Join(outDir, "src", "a.txt"))
+	require.FileExists(t, filepath.Join(outDir, "src", "z.txt"))
+	require.NoFileExists(t, filepath.Join(outDir, "src", "stall-write.txt"))
+
+	// Files written in time are not affected by timeout.
+	outDir = t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir, targz.WithEntryTimeout(timeout)))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+}
@@ -0,0 +1,131 @@
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+)
+
+// Unarchiver reads the entries of a gzip compressed tar file one at a time,
+// so that the caller decides, for each entry, whether to extract it, read its
+// data, or skip it. Call Close when done.
+type Unarchiver struct {
+	opts config
+	rc   io.ReadCloser
+	tr   *tar.Reader
+	hdr  *tar.Header
+	err  error
+	// Extractor for each target directory that entries are extracted to.
+	extractors map[string]*extractor
+}
+
+// NewUnarchiver returns an Unarchiver that reads an archive from r. The
+// compression format is detected from the data, as with ExtractReader. If the
+// data cannot be read, then the error is returned by Next.
+func NewUnarchiver(r io.Reader, options ...Option) *Unarchiver {
+	u := &Unarchiver{
+		opts: getOpts(options),
+	}
+	u.rc, u.err = decompressReader(countCompressed(r, &u.opts), &u.opts)
+	if u.err == nil {
+		u.tr = tar.NewReader(u.rc)
+	}
+	return u
+}
+
+// Next advances to the next entry in the archive, and returns its
+// description. Any data of the previous entry that was not read is skipped.
+// At the end of the archive, Next returns io.EOF.
+func (u *Unarchiver) Next() (*Entry, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	u.hdr = nil
+	for {
+		hdr, err := u.tr.Next()
+		if err != nil {
+			u.err = err
+			return nil, err
+		}
+		if err = u.opts.ctxErr(); err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		u.hdr = hdr
+		entry := entryFromHeader(hdr)
+		return &entry, nil
+	}
+}
+
+// Read reads the data of the current entry. It returns io.EOF at the end of
+// the entry's data.
+func (u *Unarchiver) Read(p []byte) (int, error) {
+	if u.hdr == nil {
+		return 0, errNoEntry
+	}
+	return u.tr.Read(p)
+}
+
+// WriteTo writes the remaining data of the current entry to w.
+func (u *Unarchiver) WriteTo(w io.Writer) (int64, error) {
+	if u.hdr == nil {
+		return 0, errNoEntry
+	}
+	return copyContext(u.opts.ctx, w, u.tr)
+}
+
+// Extract extracts the current entry into the target directory, the same as
+// ExtractReader would, using the Unarchiver's options. Work that extraction
+// does after all entries are written, such as setting the modification times
+// of directories, is done by Close.
+func (u *Unarchiver) Extract(targetDir string) error {
+	if u.hdr == nil {
+		return errNoEntry
+	}
+	x, ok := u.extractors[targetDir]
+	if !ok {
+		x = newExtractor(targetDir, &u.opts)
+		if u.extractors == nil {
+			u.extractors = map[string]*extractor{}
+		}
+		u.extractors[targetDir] = x
+	}
+	hdr := u.hdr
+	// Data is consumed by extraction.
+	u.hdr = nil
+	if !u.opts.selectEntry(hdr) {
+		return nil
+	}
+	return x.extractEntry(hdr, u.tr)
+}
+
+// Close finishes any extraction, and releases the decompressor. It does not
+// close the underlying reader.
+func (u *Unarchiver) Close() error {
+	var err error
+	for _, x := range u.extractors {
+		if finishErr := x.finish(); finishErr != nil && err == nil {
+			err = finishErr
+		}
+	}
+	u.extractors = nil
+	if u.rc != nil {
+		if closeErr := u.rc.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		u.rc = nil
+	}
+	u.hdr = nil
+	u.err = errUnarchiverClosed
+	return err
+}
+
+var (
+	// errNoEntry is returned when reading an entry before calling Next.
+	errNoEntry = errors.New("no current entry")
+	// errUnarchiverClosed is returned when using an Unarchiver after it is
+	// closed.
+	errUnarchiverClosed = errors.New("unarchiver is closed")
+)
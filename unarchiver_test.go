@@ -0,0 +1,65 @@
+package targz_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnarchiver(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	for name, data := range map[string]string{
+		"a.txt":     "alpha",
+		"b.txt":     "beta",
+		"sub/c.txt": "gamma",
+		"sub/d.txt": "delta",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, filepath.FromSlash(name)), []byte(data), 0640))
+	}
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+
+	outDir := t.TempDir()
+	u := targz.NewUnarchiver(&buf)
+	var names []string
+	var bData bytes.Buffer
+	var aData []byte
+	for {
+		entry, err := u.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, entry.Name)
+		switch entry.Name {
+		case "src/a.txt":
+			aData, err = io.ReadAll(u)
+			require.NoError(t, err)
+		case "src/b.txt":
+			n, err := u.WriteTo(&bData)
+			require.NoError(t, err)
+			require.Equal(t, entry.Size, n)
+		case "src/sub/", "src/sub/c.txt":
+			require.NoError(t, u.Extract(outDir))
+		}
+	}
+	require.NoError(t, u.Close())
+
+	require.Equal(t, []string{"src/", "src/a.txt", "src/b.txt", "src/sub/", "src/sub/c.txt", "src/sub/d.txt"}, names)
+	require.Equal(t, "alpha", string(aData))
+	require.Equal(t, "beta", bData.String())
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "sub", "c.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "gamma", string(data))
+	require.NoFileExists(t, filepath.Join(outDir, "src", "sub", "d.txt"))
+	require.NoFileExists(t, filepath.Join(outDir, "src", "a.txt"))
+
+	_, err = u.Next()
+	require.Error(t, err)
+}
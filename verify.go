@@ -0,0 +1,135 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrMismatch is returned when the files in a directory do not match the
+// contents of an archive.
+var ErrMismatch = errors.New("extracted files do not match archive")
+
+// VerifyExtraction checks that the contents of dir match what extracting the
+// archive at tarPath into dir produces. Each archived entry must exist in dir
+// with the same type, and regular files must have the same size. If the
+// WithVerifyContent option is enabled, then the content of each file is also
+// compared with the archive content. Any file under dir that is not in the
+// archive, or is not a directory containing archived entries, also causes
+// verification to fail.
+//
+// An error wrapping ErrMismatch is returned if verification fails.
+func VerifyExtraction(tarPath, dir string, options ...Option) error {
+	opts := getOpts(options)
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rc, err := decompressReader(f, &opts)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	dir = filepath.Clean(dir)
+	expected := map[string]struct{}{}
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		// Directories that contain the entry are created by extraction, even
+		// if the archive has no entries for them.
+		for d := filepath.Dir(target); d != dir && withinDir(dir, d); d = filepath.Dir(d) {
+			if _, found := expected[d]; found {
+				break
+			}
+			expected[d] = struct{}{}
+		}
+		expected[target] = struct{}{}
+
+		fi, err := os.Lstat(target)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("%w: %s is missing", ErrMismatch, hdr.Name)
+			}
+			return err
+		}
+
+		switch {
+		case isDirEntry(hdr):
+			if !fi.IsDir() {
+				return fmt.Errorf("%w: %s is not a directory", ErrMismatch, hdr.Name)
+			}
+		case hdr.Typeflag == tar.TypeSymlink:
+			if fi.Mode()&os.ModeSymlink == 0 {
+				return fmt.Errorf("%w: %s is not a symbolic link", ErrMismatch, hdr.Name)
+			}
+			linkname, err := os.Readlink(target)
+			if err != nil {
+				return err
+			}
+			if linkname != hdr.Linkname {
+				return fmt.Errorf("%w: %s links to %s, expected %s", ErrMismatch, hdr.Name, linkname, hdr.Linkname)
+			}
+		case hdr.Typeflag == tar.TypeReg, hdr.Typeflag == tar.TypeLink:
+			if !fi.Mode().IsRegular() {
+				return fmt.Errorf("%w: %s is not a regular file", ErrMismatch, hdr.Name)
+			}
+			if hdr.Typeflag == tar.TypeLink {
+				break
+			}
+			if fi.Size() != hdr.Size {
+				return fmt.Errorf("%w: %s size is %d, expected %d", ErrMismatch, hdr.Name, fi.Size(), hdr.Size)
+			}
+			if opts.verifyContent {
+				h := sha256.New()
+				if _, err = io.Copy(h, tr); err != nil {
+					return err
+				}
+				sum, err := hashFile(target)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(sum[:], h.Sum(nil)) {
+					return fmt.Errorf("%w: %s content differs", ErrMismatch, hdr.Name)
+				}
+			}
+		}
+	}
+
+	// Check for files that are not in the archive.
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		if _, found := expected[p]; !found {
+			rel, _ := filepath.Rel(dir, p)
+			return fmt.Errorf("%w: %s is not in archive", ErrMismatch, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package targz_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyExtraction(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("world"), 0640))
+
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath))
+
+	outDir := filepath.Join(tmpDir, "out")
+	require.NoError(t, os.Mkdir(outDir, 0750))
+	require.NoError(t, targz.Extract(tarPath, outDir))
+
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir, targz.WithVerifyContent(true)))
+
+	// Modify content without changing size.
+	bPath := filepath.Join(outDir, "src", "sub", "b.txt")
+	require.NoError(t, os.WriteFile(bPath, []byte("WORLD"), 0640))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+	err := targz.VerifyExtraction(tarPath, outDir, targz.WithVerifyContent(true))
+	require.ErrorIs(t, err, targz.ErrMismatch)
+	require.ErrorContains(t, err, "src/sub/b.txt")
+
+	// Change size.
+	require.NoError(t, os.WriteFile(bPath, []byte("world!"), 0640))
+	err = targz.VerifyExtraction(tarPath, outDir)
+	require.ErrorIs(t, err, targz.ErrMismatch)
+
+	// Missing file.
+	require.NoError(t, os.Remove(bPath))
+	err = targz.VerifyExtraction(tarPath, outDir)
+	require.ErrorIs(t, err, targz.ErrMismatch)
+	require.ErrorContains(t, err, "missing")
+
+	// Extra file.
+	require.NoError(t, os.WriteFile(bPath, []byte("world"), 0640))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "src", "extra"), nil, 0640))
+	err = targz.VerifyExtraction(tarPath, outDir)
+	require.ErrorIs(t, err, targz.ErrMismatch)
+	require.ErrorContains(t, err, "src/extra is not in archive")
+}
+
+func TestVerifyExtractionOmitDirEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub", "deep"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "deep", "a.txt"), []byte("a"), 0640))
+
+	tarPath := filepath.Join(tmpDir, "test.tar.gz")
+	require.NoError(t, targz.Create(srcDir, tarPath, targz.WithOmitDirEntries(true)))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.Extract(tarPath, outDir))
+	require.NoError(t, targz.VerifyExtraction(tarPath, outDir))
+
+	// Directory that contains no archived entries is not expected.
+	require.NoError(t, os.Mkdir(filepath.Join(outDir, "src", "empty"), 0750))
+	err := targz.VerifyExtraction(tarPath, outDir)
+	require.ErrorIs(t, err, targz.ErrMismatch)
+	require.ErrorContains(t, err, "src/empty is not in archive")
+}
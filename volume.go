@@ -0,0 +1,198 @@
+package targz
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CreateVolumes creates a sequence of compressed tar files, called volumes,
+// that together contain the contents of the specified directory. Volumes are
+// named by appending a sequence number and the extension for the codec to
+// basePath, as in "basePath.001.tar.gz", "basePath.002.tar.gz", etc., or
+// "basePath.001.tar.zst" when using CodecZstd. The names of the created
+// volumes are returned in order.
+//
+// Files are added to a volume until adding another file would make the total
+// size of the volume's file data exceed maxSize, and then a new volume is
+// started. The size is of the uncompressed file data, so a compressed volume
+// is usually smaller than maxSize, and headers are not counted. A file is never split across volumes, so an error is returned if
+// any single file is larger than maxSize. Each volume contains the directory
+// entries needed for its files, so each volume can be extracted on its own to
+// produce part of the directory tree. Use ExtractVolumes to extract all volumes
+// to reconstruct the complete directory tree.
+func CreateVolumes(dir, basePath string, maxSize int64, options ...Option) ([]string, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid volume size %d", maxSize)
+	}
+	opts := getOpts(options)
+
+	parent, dir, err := splitParent(opts.resolvePath(dir))
+	if err != nil {
+		return nil, err
+	}
+	name, err := opts.rootName(dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.ToSlash(dir)
+
+	// Collect all entries, and check that each file fits in a volume, before
+	// writing any volume.
+	var entries []archiveEntry
+	dirEntries := map[string]archiveEntry{}
+	err = walkDir(parent, dir, &opts, func(e archiveEntry) error {
+		e.name = name + strings.TrimPrefix(e.name, prefix)
+		if e.info.IsDir() {
+			dirEntries[e.name] = e
+		} else if e.info.Size() > maxSize {
+			return fmt.Errorf("file %s size %d exceeds volume size %d", e.name, e.info.Size(), maxSize)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes []string
+	for len(entries) != 0 {
+		volPath := fmt.Sprintf("%s.%03d%s", basePath, len(volumes)+1, opts.codec.extension())
+		f, err := os.Create(volPath)
+		if err != nil {
+			return volumes, err
+		}
+		volumes = append(volumes, volPath)
+
+		global := map[string]string{paxVolume: strconv.Itoa(len(volumes))}
+		err = writeArchive(f, &opts, global, func(tw *tar.Writer) error {
+			var err error
+			entries, err = writeVolume(tw, &opts, name, entries, dirEntries, maxSize)
+			return err
+		})
+		if err != nil {
+			f.Close()
+			return volumes, err
+		}
+		if err = f.Close(); err != nil {
+			return volumes, err
+		}
+	}
+	return volumes, nil
+}
+
+// writeVolume writes entries to the tar writer until the volume is full, and
+// returns the entries that were not written.
+func writeVolume(tw *tar.Writer, opts *config, root string, entries []archiveEntry, dirEntries map[string]archiveEntry, maxSize int64) ([]archiveEntry, error) {
+	a := newArchiver(tw, opts, root)
+	written := map[string]struct{}{}
+
+	// addDirs writes the entries for any directories containing name that
+	// are not yet written to this volume.
+	var addDirs func(name string) error
+	addDirs = func(name string) error {
+		dirName := path.Dir(name) + "/"
+		if _, found := written[dirName]; found {
+			return nil
+		}
+		parent, ok := dirEntries[dirName]
+		if !ok {
+			return nil
+		}
+		if err := addDirs(path.Dir(name)); err != nil {
+			return err
+		}
+		written[dirName] = struct{}{}
+		return a.addEntry(parent)
+	}
+
+	var volSize int64
+	for i, e := range entries {
+		if e.info.IsDir() {
+			if err := addDirs(e.name[:len(e.name)-1]); err != nil {
+				return nil, err
+			}
+			written[e.name] = struct{}{}
+			if err := a.addEntry(e); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		size := e.info.Size()
+		if volSize != 0 && volSize+size > maxSize {
+			return entries[i:], nil
+		}
+		volSize += size
+		if err := addDirs(e.name); err != nil {
+			return nil, err
+		}
+		if err := a.addEntry(e); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// ExtractVolumes extracts each of the volumes, created by CreateVolumes, into
+// the target directory, reconstructing the complete directory tree. The
+// volumes must be given in order. If the volumes contain sequence numbers,
+// then these are checked to ensure that the volumes are in order and that
+// none are missing, before any volume is extracted.
+func ExtractVolumes(paths []string, targetDir string, options ...Option) error {
+	for i, volPath := range paths {
+		seq, err := volumeNumber(volPath, options)
+		if err != nil {
+			return err
+		}
+		if seq != 0 && seq != i+1 {
+			return fmt.Errorf("volume %s is number %d, expected %d", volPath, seq, i+1)
+		}
+	}
+	for _, volPath := range paths {
+		if err := Extract(volPath, targetDir, options...); err != nil {
+			return fmt.Errorf("cannot extract volume %s: %w", volPath, err)
+		}
+	}
+	return nil
+}
+
+// volumeNumber returns the sequence number of the volume, or 0 if the volume
+// does not have a sequence number.
+func volumeNumber(volPath string, options []Option) (int, error) {
+	opts := getOpts(options)
+	f, err := os.Open(volPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	rc, err := decompressReader(f, &opts)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	hdr, err := tar.NewReader(rc).Next()
+	if err != nil {
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if hdr.Typeflag != tar.TypeXGlobalHeader {
+		return 0, nil
+	}
+	seqStr, ok := hdr.PAXRecords[paxVolume]
+	if !ok {
+		return 0, nil
+	}
+	seq, err := strconv.Atoi(seqStr)
+	if err != nil || seq < 1 {
+		return 0, fmt.Errorf("volume %s has invalid sequence number %q", volPath, seqStr)
+	}
+	return seq, nil
+}
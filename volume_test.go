@@ -0,0 +1,135 @@
+package targz_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateVolumes(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	files := []string{"a.txt", "b.txt", "c.txt", "sub/d.txt", "sub/deep/e.txt"}
+	for i, name := range files {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, bytes.Repeat([]byte{'a' + byte(i)}, 40), 0640))
+	}
+
+	basePath := filepath.Join(tmpDir, "backup")
+	volumes, err := targz.CreateVolumes(srcDir, basePath, 100)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		basePath + ".001.tar.gz",
+		basePath + ".002.tar.gz",
+		basePath + ".003.tar.gz",
+	}, volumes)
+
+	// Each volume extracts to part of the tree.
+	found := map[string]int{}
+	for _, vol := range volumes {
+		outDir := t.TempDir()
+		require.NoError(t, targz.Extract(vol, outDir))
+		var count int
+		err = filepath.Walk(outDir, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(filepath.Join(outDir, "src"), p)
+			if err != nil {
+				return err
+			}
+			found[filepath.ToSlash(rel)]++
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		require.LessOrEqual(t, count, 2)
+		require.NotZero(t, count)
+	}
+
+	// All files are in exactly one volume.
+	require.Len(t, found, len(files))
+	for _, name := range files {
+		require.Equal(t, 1, found[name])
+	}
+}
+
+func TestCreateVolumesZstd(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), bytes.Repeat([]byte(name), 20), 0640))
+	}
+
+	basePath := filepath.Join(tmpDir, "backup")
+	volumes, err := targz.CreateVolumes(srcDir, basePath, 100, targz.WithCodec(targz.CodecZstd))
+	require.NoError(t, err)
+	require.Equal(t, []string{basePath + ".001.tar.zst", basePath + ".002.tar.zst"}, volumes)
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractVolumes(volumes, outDir, targz.WithCodec(targz.CodecZstd)))
+	data, err := os.ReadFile(filepath.Join(outDir, "src", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat([]byte("b.txt"), 20), data)
+}
+
+func TestCreateVolumesFileTooLarge(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "big"), make([]byte, 101), 0640))
+
+	basePath := filepath.Join(tmpDir, "backup")
+	_, err := targz.CreateVolumes(srcDir, basePath, 100)
+	require.ErrorContains(t, err, "exceeds volume size")
+	_, err = os.Stat(basePath + ".001.tar.gz")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestExtractVolumes(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	files := []string{"a.txt", "b.txt", "sub/c.txt", "sub/d.txt", "sub/deep/e.txt", "z.txt"}
+	for i, name := range files {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0750))
+		require.NoError(t, os.WriteFile(p, bytes.Repeat([]byte{'a' + byte(i)}, 40), 0640))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(srcDir, "empty"), 0750))
+
+	basePath := filepath.Join(tmpDir, "backup")
+	volumes, err := targz.CreateVolumes(srcDir, basePath, 80)
+	require.NoError(t, err)
+	require.Len(t, volumes, 3)
+
+	// Volumes out of order are rejected.
+	outDir := t.TempDir()
+	reversed := []string{volumes[2], volumes[1], volumes[0]}
+	err = targz.ExtractVolumes(reversed, outDir)
+	require.ErrorContains(t, err, "expected 1")
+	entries, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	require.Empty(t, entries, "extracted volumes before validating order")
+
+	// Missing volume is detected.
+	err = targz.ExtractVolumes([]string{volumes[0], volumes[2]}, outDir)
+	require.ErrorContains(t, err, "expected 2")
+
+	require.NoError(t, targz.ExtractVolumes(volumes, outDir))
+	extracted := filepath.Join(outDir, "src")
+	for i, name := range files {
+		data, err := os.ReadFile(filepath.Join(extracted, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte{'a' + byte(i)}, 40), data)
+	}
+	fi, err := os.Stat(filepath.Join(extracted, "empty"))
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+
+}
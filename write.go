@@ -0,0 +1,124 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WriteFile writes a regular file entry, with the given name, content,
+// permissions, and modification time, to a tar writer. This is for building
+// archives from in-memory data when the caller manages the tar writer.
+//
+// The name must be a relative path that does not refer outside of the archive
+// root. Any OS-specific path separators are converted to forward slashes. The
+// header is written as given, since no options apply. To write entries using
+// options such as WithOwner or WithDeterministic, use an Archiver.
+func WriteFile(tw *tar.Writer, name string, data []byte, mode os.FileMode, mt time.Time) error {
+	name, err := cleanEntryName(name)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(data)),
+		ModTime:  mt,
+	}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// NamedReader describes a file to archive whose content is read from Reader.
+type NamedReader struct {
+	// Name is the name of the file in the archive.
+	Name string
+	// Mode holds the file permissions.
+	Mode os.FileMode
+	// ModTime is the modification time of the file.
+	ModTime time.Time
+	// Reader supplies the file content.
+	Reader io.Reader
+	// Size is the number of bytes of content read from Reader. If Size is 0,
+	// then the size is not known, and the content is read into memory to
+	// determine its size before it is written.
+	Size int64
+}
+
+// CreateFromReaders writes a gzip compressed tar file to w, containing a
+// regular file for each entry. The content of each file is streamed from its
+// reader, unless the size of the content is not given.
+//
+// Each entry name must be a relative path that does not refer outside of the
+// archive root. All names are checked before anything is written. The options
+// that apply to headers, such as WithOwner, WithDeterministic, and
+// WithHeaderMutator, are used as by Create, with the header mutator called
+// with the entry name as the file path.
+func CreateFromReaders(entries []NamedReader, w io.Writer, options ...Option) error {
+	opts := getOpts(options)
+
+	names := make([]string, len(entries))
+	for i := range entries {
+		name, err := cleanEntryName(entries[i].Name)
+		if err != nil {
+			return err
+		}
+		names[i] = name
+	}
+
+	return writeArchive(w, &opts, nil, func(tw *tar.Writer) error {
+		a := newArchiver(tw, &opts, "")
+		for i, entry := range entries {
+			r := entry.Reader
+			size := entry.Size
+			if size == 0 {
+				data, err := io.ReadAll(r)
+				if err != nil {
+					return fmt.Errorf("cannot read %s: %w", entry.Name, err)
+				}
+				r = bytes.NewReader(data)
+				size = int64(len(data))
+			}
+			hdr := &tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     names[i],
+				Mode:     int64(entry.Mode.Perm()),
+				Size:     size,
+				ModTime:  entry.ModTime,
+			}
+			if err := a.writeHeader(hdr, names[i]); err != nil {
+				return err
+			}
+			n, err := io.Copy(tw, r)
+			if err != nil {
+				return fmt.Errorf("cannot read %s: %w", entry.Name, err)
+			}
+			if n != size {
+				return fmt.Errorf("read %d bytes of %s, expected %d", n, entry.Name, size)
+			}
+		}
+		return nil
+	})
+}
+
+// cleanEntryName returns the cleaned, slash-separated, form of an archive
+// entry name, or an error if the name is not a relative path within the
+// archive root.
+func cleanEntryName(name string) (string, error) {
+	clean := path.Clean(filepath.ToSlash(name))
+	if name == "" || clean == "." || path.IsAbs(clean) || filepath.IsAbs(name) ||
+		clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid entry name %q", name)
+	}
+	return clean, nil
+}
@@ -0,0 +1,118 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	mt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, targz.WriteFile(tw, "hello.txt", []byte("hello"), 0644, mt))
+	require.NoError(t, targz.WriteFile(tw, "docs/./readme.md", []byte("# readme"), 0600, mt))
+	for _, name := range []string{"", ".", "../escape", "/abs/path", "a/../../b"} {
+		require.Error(t, targz.WriteFile(tw, name, nil, 0644, mt), "name %q", name)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir))
+
+	data, err := os.ReadFile(filepath.Join(outDir, "hello.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	p := filepath.Join(outDir, "docs", "readme.md")
+	data, err = os.ReadFile(p)
+	require.NoError(t, err)
+	require.Equal(t, "# readme", string(data))
+	fi, err := os.Stat(p)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+}
+
+func TestCreateFromReaders(t *testing.T) {
+	mt := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	entries := []targz.NamedReader{
+		{Name: "top.txt", Mode: 0640, ModTime: mt, Reader: strings.NewReader("top"), Size: 3},
+		{Name: "dir/unsized.txt", Mode: 0600, ModTime: mt, Reader: io.MultiReader(strings.NewReader("un"), strings.NewReader("sized"))},
+		{Name: `dir\deep\win.txt`, Mode: 0644, ModTime: mt, Reader: bytes.NewReader([]byte("windows"))},
+		{Name: "empty.txt", Mode: 0644, ModTime: mt, Reader: strings.NewReader("")},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateFromReaders(entries, &buf))
+
+	outDir := t.TempDir()
+	require.NoError(t, targz.ExtractReader(&buf, outDir))
+	expect := map[string]string{
+		"top.txt":          "top",
+		"dir/unsized.txt":  "unsized",
+		"dir/deep/win.txt": "windows",
+		"empty.txt":        "",
+	}
+	if filepath.Separator != '\\' {
+		// Backslash is only a separator on Windows.
+		delete(expect, "dir/deep/win.txt")
+		expect[`dir\deep\win.txt`] = "windows"
+	}
+	for name, content := range expect {
+		p := filepath.Join(outDir, filepath.FromSlash(name))
+		data, err := os.ReadFile(p)
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+
+	// Size that does not match content.
+	entries = []targz.NamedReader{{Name: "short.txt", Mode: 0644, Reader: strings.NewReader("abc"), Size: 5}}
+	require.ErrorContains(t, targz.CreateFromReaders(entries, io.Discard), "expected 5")
+
+	// Invalid name.
+	entries = []targz.NamedReader{{Name: "../escape.txt", Mode: 0644, Reader: strings.NewReader("abc")}}
+	require.ErrorContains(t, targz.CreateFromReaders(entries, io.Discard), "invalid entry name")
+}
+
+func TestCreateFromReadersHeaderOptions(t *testing.T) {
+	entries := []targz.NamedReader{
+		{Name: "a.txt", Mode: 0600, ModTime: time.Now(), Reader: strings.NewReader("a")},
+		{Name: "b.txt", Mode: 0640, ModTime: time.Now(), Reader: strings.NewReader("b")},
+	}
+	var mutated []string
+	mutator := func(hdr *tar.Header, path string) {
+		mutated = append(mutated, path)
+		hdr.Mode = 0444
+	}
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateFromReaders(entries, &buf, targz.WithDeterministic(true),
+		targz.WithOwner(1000, 1001, "user", "group"), targz.WithHeaderMutator(mutator)))
+	require.Equal(t, []string{"a.txt", "b.txt"}, mutated)
+
+	gzr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	for range entries {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		require.Equal(t, time.Unix(0, 0).Unix(), hdr.ModTime.Unix())
+		require.Equal(t, 1000, hdr.Uid)
+		require.Equal(t, 1001, hdr.Gid)
+		require.Equal(t, "user", hdr.Uname)
+		require.Equal(t, "group", hdr.Gname)
+		require.Equal(t, int64(0444), hdr.Mode)
+	}
+	_, err = tr.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
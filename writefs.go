@@ -0,0 +1,203 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+)
+
+// WriteFS is a writable filesystem that ExtractToFS writes archive entries
+// into. Names are slash-separated paths relative to the root of the
+// filesystem, as with fs.FS, and are never absolute or outside the root.
+type WriteFS interface {
+	// MkdirAll creates a directory, along with any missing parents.
+	MkdirAll(name string, perm os.FileMode) error
+	// Create creates or truncates a file, and returns a writer for its data.
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+	// Symlink creates newname as a symbolic link to oldname.
+	Symlink(oldname, newname string) error
+	// Chtimes sets the access and modification times of a file or directory.
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// ExtractToFS reads gzipped tar data from r and extracts it into fsys, instead
+// of into a directory on disk. This allows extracting into an in-memory or
+// other virtual filesystem.
+//
+// Directories, regular files, and symbolic links are extracted. Hard links are
+// skipped with a warning, since WriteFS cannot read back their targets, and
+// other types of entries are skipped. Options for file ownership and other
+// disk-specific behavior are not applied. When using WithVerifyChecksums, the
+// data of each file that has a checksum is held in memory and verified before
+// the file is created, since WriteFS cannot remove a file that does not match.
+func ExtractToFS(r io.Reader, fsys WriteFS, options ...Option) error {
+	opts := getOpts(options)
+	rc, err := decompressReader(countCompressed(r, &opts), &opts)
+	if err != nil {
+		if errors.Is(err, ErrEmptyArchive) && opts.allowEmpty {
+			return nil
+		}
+		return err
+	}
+	defer rc.Close()
+
+	x := &fsExtractor{
+		fsys: fsys,
+		opts: &opts,
+	}
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err = opts.ctxErr(); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if !opts.selectEntry(header) {
+			continue
+		}
+		if err = x.writeEntry(header, tr); err != nil {
+			return err
+		}
+	}
+
+	// Set directory times after their contents are written.
+	sortDeepestFirst(x.dirTimes)
+	for _, dt := range x.dirTimes {
+		if err = fsys.Chtimes(dt.path, dt.modTime, dt.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsExtractor writes archive entries into a WriteFS.
+type fsExtractor struct {
+	fsys WriteFS
+	opts *config
+	// Modification times to set on directories after all entries are
+	// extracted.
+	dirTimes []dirTime
+	// Bytes of file data extracted, when limiting the total size.
+	extracted atomic.Int64
+}
+
+// writeEntry writes the entry described by header to the filesystem, reading
+// any file data from r.
+func (x *fsExtractor) writeEntry(header *tar.Header, r io.Reader) error {
+	name := path.Clean(header.Name)
+	if name == "." {
+		return nil
+	}
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("%w: entry %q", ErrOutsideTarget, header.Name)
+	}
+	mode := x.opts.extractMode(header)
+
+	switch {
+	case isDirEntry(header):
+		if err := x.fsys.MkdirAll(name, mode.Perm()); err != nil {
+			return err
+		}
+		if !x.opts.skipRestoreTimes && !header.ModTime.IsZero() {
+			x.dirTimes = append(x.dirTimes, dirTime{
+				path:    name,
+				modTime: header.ModTime,
+			})
+		}
+		return nil
+	case header.Typeflag == tar.TypeSymlink:
+		if !x.opts.allowEscapingLinks && symlinkEscapes(header.Name, header.Linkname) {
+			return fmt.Errorf("%w: %s links to %s", ErrEscapingLink, header.Name, header.Linkname)
+		}
+		if err := x.makeParentDirs(name); err != nil {
+			return err
+		}
+		return x.fsys.Symlink(header.Linkname, name)
+	case header.Typeflag == tar.TypeLink:
+		x.opts.warn(fmt.Sprintf("skipping hard link %s to %s", header.Name, header.Linkname))
+		return nil
+	case !mode.IsRegular():
+		// Other types of entries are not extracted.
+		return nil
+	}
+
+	if err := x.makeParentDirs(name); err != nil {
+		return err
+	}
+	if x.opts.maxSize > 0 || x.opts.maxFileSize > 0 {
+		r = &sizeLimitReader{
+			r:        r,
+			name:     header.Name,
+			maxFile:  x.opts.maxFileSize,
+			maxTotal: x.opts.maxSize,
+			total:    &x.extracted,
+		}
+	}
+	// Read and hash the file data, as read from the archive, to verify the
+	// checksum before the file is created, since WriteFS cannot remove it.
+	if wantSum, ok := header.PAXRecords[paxSHA256]; ok && x.opts.verifyChecksums {
+		h := sha256.New()
+		var buf bytes.Buffer
+		if _, err := copyContext(x.opts.ctx, &buf, io.TeeReader(r, h)); err != nil {
+			return err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != wantSum {
+			err := fmt.Errorf("%w: %s", ErrChecksumMismatch, header.Name)
+			if x.opts.skipBadChecksums {
+				x.opts.warn(err.Error())
+				return nil
+			}
+			return err
+		}
+		r = &buf
+	}
+	if x.opts.extractTransform != nil {
+		r = x.opts.extractTransform(header.Name, r)
+	}
+	f, err := x.fsys.Create(name, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = copyContext(x.opts.ctx, f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if !x.opts.skipRestoreTimes && !header.ModTime.IsZero() {
+		return x.fsys.Chtimes(name, header.ModTime, header.ModTime)
+	}
+	return nil
+}
+
+// makeParentDirs creates the directory that contains name, in case the archive
+// does not contain an entry for it or it comes after the entries it contains.
+func (x *fsExtractor) makeParentDirs(name string) error {
+	dir := path.Dir(name)
+	if dir == "." {
+		return nil
+	}
+	mode := os.FileMode(defaultDirMode)
+	if x.opts.defaultDirMode != 0 {
+		mode = x.opts.defaultDirMode
+	}
+	return x.fsys.MkdirAll(dir, mode)
+}
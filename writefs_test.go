@@ -0,0 +1,158 @@
+package targz_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gammazero/targz"
+	"github.com/stretchr/testify/require"
+)
+
+// memFS is an in-memory targz.WriteFS.
+type memFS struct {
+	dirs     map[string]os.FileMode
+	files    map[string]*memFile
+	links    map[string]string
+	modTimes map[string]time.Time
+}
+
+type memFile struct {
+	bytes.Buffer
+	perm os.FileMode
+}
+
+func (f *memFile) Close() error { return nil }
+
+func newMemFS() *memFS {
+	return &memFS{
+		dirs:     map[string]os.FileMode{},
+		files:    map[string]*memFile{},
+		links:    map[string]string{},
+		modTimes: map[string]time.Time{},
+	}
+}
+
+func (m *memFS) MkdirAll(name string, perm os.FileMode) error {
+	for ; name != "."; name = path.Dir(name) {
+		if _, ok := m.dirs[name]; !ok {
+			m.dirs[name] = perm
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	if _, ok := m.dirs[path.Dir(name)]; !ok && path.Dir(name) != "." {
+		return nil, os.ErrNotExist
+	}
+	f := &memFile{perm: perm}
+	m.files[name] = f
+	return f, nil
+}
+
+func (m *memFS) Symlink(oldname, newname string) error {
+	m.links[newname] = oldname
+	return nil
+}
+
+func (m *memFS) Chtimes(name string, _, mtime time.Time) error {
+	m.modTimes[name] = mtime
+	return nil
+}
+
+func TestExtractToFS(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("world"), 0600))
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(srcDir, "a.txt"), modTime, modTime))
+
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf))
+	fsys := newMemFS()
+	require.NoError(t, targz.ExtractToFS(&buf, fsys))
+
+	require.Contains(t, fsys.dirs, "src")
+	require.Equal(t, os.FileMode(0750), fsys.dirs["src/sub"])
+	require.Len(t, fsys.files, 2)
+	require.Equal(t, "hello", fsys.files["src/a.txt"].String())
+	require.Equal(t, os.FileMode(0640), fsys.files["src/a.txt"].perm)
+	require.Equal(t, "world", fsys.files["src/sub/b.txt"].String())
+	require.True(t, modTime.Equal(fsys.modTimes["src/a.txt"]))
+
+	// Entries outside of root are rejected.
+	buf.Reset()
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "../escape.txt",
+		Mode:     0640,
+	}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	fsys = newMemFS()
+	require.ErrorIs(t, targz.ExtractToFS(&buf, fsys), targz.ErrOutsideTarget)
+	require.Empty(t, fsys.files)
+}
+
+func TestExtractToFSVerifyChecksums(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.Mkdir(srcDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("good a"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("good b"), 0640))
+	var buf bytes.Buffer
+	require.NoError(t, targz.CreateWriter(srcDir, &buf, targz.WithChecksums(true)))
+
+	// Copy archive, changing content of a.txt but not its checksum.
+	gzr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gzr)
+	var tampered bytes.Buffer
+	gzw := gzip.NewWriter(&tampered)
+	tw := tar.NewWriter(gzw)
+	for hdr, err := tr.Next(); err != io.EOF; hdr, err = tr.Next() {
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if hdr.Name == "src/a.txt" {
+			data = []byte("evil a")
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	archive := tampered.Bytes()
+
+	fsys := newMemFS()
+	require.NoError(t, targz.ExtractToFS(bytes.NewReader(archive), fsys))
+	require.Equal(t, "evil a", fsys.files["src/a.txt"].String())
+
+	// File that does not match is not created.
+	fsys = newMemFS()
+	err = targz.ExtractToFS(bytes.NewReader(archive), fsys, targz.WithVerifyChecksums(true))
+	require.ErrorIs(t, err, targz.ErrChecksumMismatch)
+	require.ErrorContains(t, err, "src/a.txt")
+	require.NotContains(t, fsys.files, "src/a.txt")
+
+	var warnings []string
+	fsys = newMemFS()
+	err = targz.ExtractToFS(bytes.NewReader(archive), fsys, targz.WithVerifyChecksums(true),
+		targz.WithSkipBadChecksums(true), targz.WithWarningHandler(func(msg string) {
+			warnings = append(warnings, msg)
+		}))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.NotContains(t, fsys.files, "src/a.txt")
+	require.Equal(t, "good b", fsys.files["src/b.txt"].String())
+}